@@ -1,10 +1,8 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
-	"log"
 	"os"
 	"regexp"
 	"slices"
@@ -14,16 +12,17 @@ import (
 )
 
 type Node struct {
-	Type     string
-	DType    string
-	Value    string
-	Declared []*Node
-	Params   []*Node
-	Returns  []*Node
-	Body     []*Node
-	Left     *Node
-	Right    *Node
-	Scope    string
+	Type    string
+	DType   string
+	Value   string
+	Params  []*Node
+	Returns []*Node
+	Body    []*Node
+	Left    *Node
+	Right   *Node
+	Scope   string
+	Pos     Position
+	Doc     string // text of the "///" comments right before a function or global
 }
 
 type Symbol struct {
@@ -33,24 +32,39 @@ type Symbol struct {
 
 var DeclaredFunctions ValueTable
 
-var line int
+// DeclaredStructs holds a STRUCT_DECL per struct type, with its fields as
+// DECLARATIONs in Params
+var DeclaredStructs ValueTable
+
+// DeclaredEnums holds an ENUM_DECL per enum type, with its members as
+// ENUM_MEMBERs in Params
+var DeclaredEnums ValueTable
 
 func main() {
 	startTime := time.Now()
 
 	debug := false // set to true to print trees before and after optimization
 
-	line++
 	root := Node{}
 	var inputFile string = getFlags()
-	code := readLines(inputFile)
+	code := lexFile(inputFile)
 
 	startParsing := time.Now()
 	newRoot := parse(code, &root)
 	fmt.Printf("Parsing took %v\n", time.Since(startParsing))
+	exitOnErrors()
 	if debug {
 		printAST(newRoot)
 	}
+
+	// errors found while optimizing stop the compile at the statement they're in
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			recoverStatement(recovered)
+			exitOnErrors()
+		}
+	}()
+
 	startOptimization := time.Now()
 	optimizedAST := optimizer(newRoot)
 	if debug {
@@ -58,6 +72,7 @@ func main() {
 	}
 	finalRound(&optimizedAST)
 	fmt.Printf("Optimization took %v\n", time.Since(startOptimization))
+	exitOnErrors()
 	finalRound(&optimizedAST)
 	if debug {
 		printAST(&optimizedAST)
@@ -75,8 +90,18 @@ func main() {
 	fmt.Println("Finished! 【=◈ ︿◈ =】Total:", totalTime)
 }
 
+// exitOnErrors prints the diagnostics so far and stops if any of them is an error
+func exitOnErrors() {
+	failed := hasErrors()
+	printDiagnostics()
+	if failed {
+		os.Exit(3)
+	}
+}
+
 func getFlags() string {
 	inputFile := flag.String("file", "", "")
+	flag.BoolVar(&WarnShadow, "shadow", true, "warn when a declaration shadows one in an enclosing scope")
 	flag.Parse()
 	if string(*inputFile) == "" {
 		fmt.Printf("no file to compile provided")
@@ -85,276 +110,292 @@ func getFlags() string {
 	return string(*inputFile)
 }
 
-// read lines
-func readLines(inputFile string) []string {
-	code := []string{}
-	// open file
-	f, err := os.Open(inputFile)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// close please
-	defer f.Close()
-
-	// read the file line by line using scanner
-	scanner := bufio.NewScanner(f)
-
-	// for each line, append the line to the code array
-	for scanner.Scan() {
-		// splits line into tokens
-		re := regexp.MustCompile(`"(.*?)"|\S+`)
-		tokens := re.FindAllString(scanner.Text(), -1)
-		splitStringInPlace(&tokens)
-		removeComments(&tokens)
-		tokens = append(tokens, "\n")
-		code = append(code, tokens...)
-	}
-
-	if err := scanner.Err(); err != nil {
-		log.Fatal(err)
-	}
-
-	return code
-}
-
 // Parse (big slay)
-func parse(tokens []string, root *Node) *Node {
+func parse(tokens []Token, root *Node) *Node {
 	body := []*Node{}
 
+	// "///" lines wait here for the statement after them
+	doc := ""
+	var docPos Position
+
 	// iterate through code
 	for i := 0; i < len(tokens); i += 0 {
+		start := i
+
+		// a statement with an error is skipped whole, and parsing carries on after it
+		func() {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					recoverStatement(recovered)
+					i = skipStatement(tokens, start)
+				}
+			}()
 
-		token := tokens[i]
-
-		switch {
-		case token == "write":
-			endLineIndex := findEndLine(tokens[i:]) + i
-
-			writeNode := parseWrite(tokens[i:endLineIndex], line, root)
+			token := tokens[i].Text
 
-			body = append(body, &writeNode)
+			statementDoc := ""
+			if tokens[i].Kind != "DOC" && token != "\n" {
+				statementDoc, doc = doc, ""
+				if statementDoc != "" && token != "func" && token != "global" {
+					warningAt(docPos, "Doc comment is not followed by a function or global declaration")
+				}
+			}
 
-			i = endLineIndex
+			switch {
+			case tokens[i].Kind == "DOC":
+				if doc == "" {
+					docPos = tokens[i].Position
+					doc = tokens[i].Text
+				} else {
+					doc += "\n" + tokens[i].Text
+				}
+				i++
 
-		case token == "func":
+			case token == "write":
+				endLineIndex := findEndLine(tokens[i:]) + i
 
-			endFunctionDeclIndex := slices.Index(tokens[i:], "{") + i
-			closingBraceIndex := findMatchingBrace(tokens[endFunctionDeclIndex:], 0) + endFunctionDeclIndex
-			if closingBraceIndex == -1 {
-				fmt.Println("No closing brace found! Line:", line)
-				os.Exit(3)
-			}
+				writeNode := parseWrite(tokens[i:endLineIndex], root)
 
-			funcNode := parseFunc(tokens[i:endFunctionDeclIndex+1], line)
+				body = append(body, &writeNode)
 
-			funcNode.Declared = append(funcNode.Declared, passGlobals(root)...)
-			DeclaredFunctions.Body = append(DeclaredFunctions.Body, funcNode)
+				i = endLineIndex
 
-			isValid := symbolMan(root, funcNode)
+			case token == "func":
 
-			parse(tokens[endFunctionDeclIndex+1:closingBraceIndex], funcNode)
+				endFunctionDeclIndex := indexToken(tokens[i:], "{") + i
+				closingBraceIndex := findMatchingBrace(tokens[endFunctionDeclIndex:], 0) + endFunctionDeclIndex
+				if closingBraceIndex == -1 {
+					errorAt(tokens[i].Position, "No closing brace found!")
+				}
 
-			if !isValid {
-				//fmt.Println(funcNode.Value + " has already been declared! Error line: " + strconv.Itoa(line))
-				//os.Exit(3)
-			}
+				funcNode := parseFunc(tokens[i : endFunctionDeclIndex+1])
+
+				funcNode.Doc = statementDoc
+				funcSymbol := symbolNode(funcNode.Value, funcNode.Type, funcNode.DType, "LOCAL", funcNode.Pos)
+				funcSymbol.Doc = statementDoc
+				declareSymbol(funcSymbol)
+				DeclaredFunctions.Body = append(DeclaredFunctions.Body, funcNode)
+
+				// the params and the body share the function's scope
+				openScope("FUNCTION")
+				defer closeScope()
+				currentFunction = funcNode
+				for _, param := range funcNode.Params {
+					declareSymbol(param)
+					declareFields(param, "LOCAL")
+				}
 
-			root.Declared = append(root.Declared, symbolNode(funcNode.Value, funcNode.Type, funcNode.DType, "LOCAL"))
+				parse(tokens[endFunctionDeclIndex+1:closingBraceIndex], funcNode)
+				currentFunction = nil
 
-			body = append(body, funcNode)
+				body = append(body, funcNode)
 
-			i = closingBraceIndex + 1
+				i = closingBraceIndex + 1
+				checkFunctionEnd(funcNode, tokens[closingBraceIndex].Position)
 
-		case token == "int" || token == "string" || token == "char" || token == "float" || token == "bool":
+			case token == "struct":
+				structNode, tokensConsumed := parseStruct(tokens[i:], root)
+				DeclaredStructs.Body = append(DeclaredStructs.Body, structNode)
+				i += tokensConsumed
 
-			endLineIndex := findEndLine(tokens[i:]) + i
-			declLine := tokens[i:endLineIndex]
-			declNode := parseDecl(declLine, line)
+			case token == "enum":
+				enumNode, tokensConsumed := parseEnum(tokens[i:], root)
+				DeclaredEnums.Body = append(DeclaredEnums.Body, enumNode)
+				i += tokensConsumed
 
-			// check if valid
-			isValid := symbolMan(root, declNode)
-			if !isValid {
-				//fmt.Println(declNode.Value + " has already been declared!")
-				//os.Exit(3)
-			}
+			case token == "int" || token == "string" || token == "char" || token == "float" || token == "bool" || isStructType(token) || isEnumType(token):
 
-			declNode.Scope = "LOCAL"
-			root.Declared = append(root.Declared, symbolNode(declNode.Value, declNode.Type, declNode.DType, declNode.Scope))
+				endLineIndex := findEndLine(tokens[i:]) + i
+				declLine := tokens[i:endLineIndex]
+				declNode := parseDecl(declLine)
+				declNode.Scope = "LOCAL"
+				declareVariable(declNode)
+				body = append(body, declareStruct(declNode, len(declLine) > 2)...)
 
-			if len(declLine) > 2 {
-				if declLine[2] == "=" {
-					newNode := parseGeneric(declLine[1:], line, root)
-					body = append(body, newNode)
+				if len(declLine) > 2 {
+					if declLine[2].Text == "=" {
+						newNode := parseAssignment(declLine[1:], root)
+						body = append(body, newNode)
+					}
 				}
-			}
 
-			i = endLineIndex
+				i = endLineIndex
 
-		case token == "global":
-			endLineIndex := findEndLine(tokens[i:]) + i
+			case token == "global":
+				endLineIndex := findEndLine(tokens[i:]) + i
 
-			// skip the global token, and parse like a regular data type
-			// there really should be a check here to make sure after global is a int/char/string/etc
-			i++
-			declLine := tokens[i:endLineIndex]
-			declNode := parseDecl(declLine, line)
-
-			// check if valid
-			isValid := symbolMan(root, declNode)
-			if !isValid {
-				//fmt.Println(declNode.Value + " has already been declared!")
-				//os.Exit(3)
-			}
+				// skip the global token, and parse like a regular data type
+				// there really should be a check here to make sure after global is a int/char/string/etc
+				i++
+				if tokens[i].Text == "[" {
+					body = append(body, declareArray(root, tokens[i:endLineIndex], "GLOBAL", statementDoc)...)
+					i = endLineIndex
+					break
+				}
+				declLine := tokens[i:endLineIndex]
+				declNode := parseDecl(declLine)
+				declNode.Scope = "GLOBAL"
+				declNode.Doc = statementDoc
+				declareVariable(declNode)
+				// the declaration stays in the tree to carry its doc comment
+				body = append(body, declNode)
+				body = append(body, declareStruct(declNode, len(declLine) > 2)...)
+
+				if len(declLine) > 2 {
+					if declLine[2].Text == "=" {
+						newNode := parseAssignment(declLine[1:], root)
+						body = append(body, newNode)
+					}
+				}
 
-			declNode.Scope = "GLOBAL"
+				i = endLineIndex
 
-			root.Declared = append(root.Declared, symbolNode(declNode.Value, declNode.Type, declNode.DType, declNode.Scope))
+			case token == "const":
+				endLineIndex := findEndLine(tokens[i:]) + i
+				constNode := parseConst(tokens[i:endLineIndex], root)
 
-			if len(declLine) > 2 {
-				if declLine[2] == "=" {
-					newNode := parseGeneric(declLine[1:], line, root)
-					body = append(body, newNode)
+				// consts are seen by the functions declared after them, like globals
+				constNode.Scope = "LOCAL"
+				if currentScope.Kind == "GLOBAL" {
+					constNode.Scope = "GLOBAL"
 				}
-			}
-
-			i = endLineIndex
+				declareVariable(constNode)
+				body = append(body, constNode)
 
-		case token == "if":
-			// Pass the entire slice from 'if' onward to parseIfStatement
-			ifNode, tokensConsumed := parseIfStatement(tokens[i:], line, root)
-			body = append(body, &ifNode)
-			i += tokensConsumed
+				i = endLineIndex
 
-		case token == "for":
-			endForLoopDeclIndex := slices.Index(tokens[i:], "{") + i
+			case token == "if":
+				// Pass the entire slice from 'if' onward to parseIfStatement
+				ifNode, tokensConsumed := parseIfStatement(tokens[i:], root)
+				body = append(body, &ifNode)
+				i += tokensConsumed
 
-			closingBraceIndex := findMatchingBrace(tokens[endForLoopDeclIndex:], 0) + endForLoopDeclIndex
-			if closingBraceIndex == -1 {
-				fmt.Println("No closing brace found!")
-				os.Exit(3)
-			}
-
-			forLoopNode := parseForLoop(tokens[i:endForLoopDeclIndex], root, line)
+			case token == "switch":
+				switchNode, tokensConsumed := parseSwitch(tokens[i:], root)
+				body = append(body, &switchNode)
+				i += tokensConsumed
 
-			initNode := forLoopNode.Body[0]
+			case token == "for":
+				endForLoopDeclIndex := indexToken(tokens[i:], "{") + i
 
-			// what are you doing, stepnode?
-			stepNode := forLoopNode.Body[1]
+				closingBraceIndex := findMatchingBrace(tokens[endForLoopDeclIndex:], 0) + endForLoopDeclIndex
+				if closingBraceIndex == -1 {
+					errorAt(tokens[i].Position, "No closing brace found!")
+				}
 
-			parse(tokens[endForLoopDeclIndex+1:closingBraceIndex], forLoopNode)
+				// the variable the init declares lives in the loop header, around the body
+				openScope("LOOP")
+				defer closeScope()
+				forLoopNode := parseForLoop(tokens[i:endForLoopDeclIndex], root)
 
-			forLoopCore := forLoopIf(forLoopNode)
+				initNode := forLoopNode.Body[0]
 
-			forLoopNode.Body = nil
+				// what are you doing, stepnode?
+				stepNode := forLoopNode.Body[1]
 
-			forLoopNode.Body = append(forLoopNode.Body, initNode)
-			forLoopNode.Body = append(forLoopNode.Body, forLoopCore)
-			forLoopNode.Body = append(forLoopNode.Body, stepNode)
+				parseScoped(tokens[endForLoopDeclIndex+1:closingBraceIndex], forLoopNode, "BLOCK")
 
-			body = append(body, forLoopNode)
+				forLoopCore := forLoopIf(forLoopNode)
 
-			i = closingBraceIndex + 2
+				forLoopNode.Body = nil
 
-		case token == "while":
-			endWhileDeclIndex := slices.Index(tokens[i:], "{") + i
+				forLoopNode.Body = append(forLoopNode.Body, initNode)
+				forLoopNode.Body = append(forLoopNode.Body, forLoopCore)
+				forLoopNode.Body = append(forLoopNode.Body, stepNode)
 
-			closingBraceIndex := findMatchingBrace(tokens[endWhileDeclIndex:], 0) + endWhileDeclIndex
-			if closingBraceIndex == -1 {
-				fmt.Println("No closing brace found!")
-				os.Exit(3)
-			}
+				body = append(body, forLoopNode)
 
-			whileLoop := parseWhile(tokens[i:endWhileDeclIndex], root, line)
+				i = closingBraceIndex + 2
 
-			parse(tokens[endWhileDeclIndex+1:closingBraceIndex], whileLoop)
+			case token == "while":
+				endWhileDeclIndex := indexToken(tokens[i:], "{") + i
 
-			whileLoopCore := forLoopIf(whileLoop)
+				closingBraceIndex := findMatchingBrace(tokens[endWhileDeclIndex:], 0) + endWhileDeclIndex
+				if closingBraceIndex == -1 {
+					errorAt(tokens[i].Position, "No closing brace found!")
+				}
 
-			whileLoop.Body = nil
+				whileLoop := parseWhile(tokens[i:endWhileDeclIndex], root)
 
-			whileLoop.Body = append(whileLoop.Body, whileLoopCore)
+				parseScoped(tokens[endWhileDeclIndex+1:closingBraceIndex], whileLoop, "BLOCK")
 
-			body = append(body, whileLoop)
+				whileLoopCore := forLoopIf(whileLoop)
 
-			i = closingBraceIndex + 2
+				whileLoop.Body = nil
 
-		case token == "[":
-			var arrayDecl *Node
-			endLineIndex := findEndLine(tokens[i:]) + i
+				whileLoop.Body = append(whileLoop.Body, whileLoopCore)
 
-			declLine := tokens[i:endLineIndex]
+				body = append(body, whileLoop)
 
-			if tokens[i+1] == "]" {
-				arrayDecl = parseArrayDecl(tokens[i:endLineIndex], line)
-			}
+				i = closingBraceIndex + 2
 
-			isValid := symbolMan(root, arrayDecl)
+			case token == "do":
+				doLoop, tokensConsumed := parseDoWhile(tokens[i:], root)
+				body = append(body, doLoop)
+				i += tokensConsumed
 
-			if !isValid {
-				//fmt.Println(arrayDecl.Value + " has already been declared!")
-				//os.Exit(3)
-			}
+			case token == "[":
+				endLineIndex := findEndLine(tokens[i:]) + i
+				body = append(body, declareArray(root, tokens[i:endLineIndex], "LOCAL", "")...)
+				i = endLineIndex
 
-			root.Declared = append(root.Declared, symbolNode(arrayDecl.Value, arrayDecl.Type, arrayDecl.DType, "LOCAL"))
+			case token == "return":
+				endLineIndex := findEndLine(tokens[i:]) + i
 
-			if len(declLine) > 3 {
+				// kept even when its value doesn't parse or check out, so the
+				// function isn't also reported as missing its return
+				newNode := &Node{Type: "RETURN", Value: "return", DType: "VOID", Pos: tokens[i].Position}
+				body = append(body, newNode)
+				*newNode = *parseReturn(tokens[i:endLineIndex], root)
 
-				if declLine[4] == "=" {
-					newNode := parseGeneric(declLine[3:], line, root)
-					newNode.Right.DType = arrayDecl.DType
-					body = append(body, newNode)
+				if currentFunction == nil {
+					errorAt(newNode.Pos, "return is only allowed inside a function")
 				}
-			}
 
-			i = endLineIndex
+				root.Returns = append(root.Returns, newNode)
+				i = endLineIndex + 1
 
-		case token == "return":
-			endLineIndex := findEndLine(tokens[i:]) + i
+				checkFunctionReturnType(currentFunction, newNode)
 
-			if len(tokens[i:endLineIndex]) > 2 {
-				fmt.Println("Only one return argument allowed. Error: line " + strconv.Itoa(line))
-				os.Exit(3)
-			}
+			case token == "else":
+				// an else that belongs to an if is parsed along with it
+				errorAt(tokens[i].Position, "else without an if before it")
 
-			newNode := parseReturn(tokens[i:endLineIndex], line, root)
+			case token == "break" || token == "continue":
+				endLineIndex := findEndLine(tokens[i:]) + i
 
-			for _, declarations := range root.Declared {
-				if declarations.Value == newNode.Value {
-					newNode.DType = declarations.DType
-					break
+				// the bodies of ifs are parsed with the enclosing root, so this
+				// also covers a break nested in ifs inside the loop
+				if root.Type != "FOR_LOOP" && root.Type != "WHILE_LOOP" && root.Type != "DO_WHILE_LOOP" {
+					errorAt(tokens[i].Position, "\""+token+"\" is only allowed inside a loop")
+				}
+				if endLineIndex > i+1 {
+					errorAt(tokens[i+1].Position, "Unexpected \""+tokens[i+1].Text+"\" after "+token)
 				}
-			}
-
-			checkFunctionReturnType(root, newNode)
-
-			root.Returns = append(root.Returns, newNode)
-			root.Body = append(root.Body, newNode)
-
-			i = endLineIndex + 1
-
-		case token == "\n":
-			line++
-			i++
-		case token == ";":
-			i++
-		default:
-			endLineIndex := findEndLine(tokens[i:]) + i
-			newNode := parseGeneric(tokens[i:endLineIndex], line, root)
-
-			isValid := symbolMan(root, newNode)
 
-			if isValid {
+				body = append(body, &Node{
+					Type:  strings.ToUpper(token),
+					Value: token,
+					Pos:   tokens[i].Position,
+				})
+
+				i = endLineIndex
+
+			case token == "\n":
+				i++
+			case token == ";":
+				i++
+			default:
+				endLineIndex := findEndLine(tokens[i:]) + i
+				newNode := parseAssignment(tokens[i:endLineIndex], root)
 				body = append(body, newNode)
+				i = endLineIndex + 1
 			}
+		}()
+	}
 
-			if !isValid {
-				fmt.Println("Previously undeclared variable assignment: " + tokens[i] + " on line " + strconv.Itoa(line))
-				os.Exit(3)
-			}
-			i = endLineIndex + 1
-		}
-
+	if doc != "" {
+		warningAt(docPos, "Doc comment is not followed by a function or global declaration")
 	}
 
 	root.Body = body
@@ -362,219 +403,147 @@ func parse(tokens []string, root *Node) *Node {
 	return root
 }
 
-func symbolMan(root *Node, newNode *Node) bool {
-	var declared bool
-	var isValid bool
-
-	switch newNode.Type {
-	case "DECLARATION":
-		for i := 0; i < len(root.Declared); i++ {
-			if root.Declared[i].Value == newNode.Value {
-				declared = true
-				break
-			}
+// currentFunction is the function whose body is being parsed, nil outside
+// of one. The bodies of loops are parsed with the loop as their root, so a
+// return finds its function here
+var currentFunction *Node
+
+// checkFunctionReturnType checks the value of a return against the type its
+// function returns. A number is promoted to the return type like it would be
+// in an assignment
+func checkFunctionReturnType(funcNode *Node, returnNode *Node) {
+	if funcNode.DType == "VOID" {
+		if len(returnNode.Body) > 0 {
+			errorAt(returnNode.Pos, "Unexpected return in function "+funcNode.Value+" which is void of returns!")
 		}
-		for i := 0; i < len(root.Params); i++ {
-			if root.Params[i].Value == newNode.Value {
-				declared = true
+		return
+	}
+	if len(returnNode.Body) == 0 {
+		errorAt(returnNode.Pos, "Expected a value after return",
+			noteAt(funcNode.Pos, funcNode.Value+" is declared to return "+funcNode.DType+" here"))
+	}
 
-				break
-			}
-		}
-		if declared {
-			isValid = false
-		} else {
-			isValid = true
-		}
+	value := widenTo(returnNode.Body[0], funcNode.DType)
+	if value.DType != funcNode.DType {
+		errorAt(spanOf(value), "Returned value "+value.Value+" ("+value.DType+") does not match the return type of "+funcNode.Value+" ("+funcNode.DType+")",
+			noteAt(funcNode.Pos, funcNode.Value+" is declared to return "+funcNode.DType+" here"))
+	}
+	returnNode.Body[0] = value
+	returnNode.DType = value.DType
+}
 
-	case "FUNCTION_DECL":
-		for i := 0; i < len(root.Declared); i++ {
-			if root.Declared[i].Value == newNode.Value {
-				declared = true
-				break
-			}
-		}
-		for i := 0; i < len(root.Params); i++ {
-			if root.Params[i].Value == newNode.Value {
-				declared = true
-				break
-			}
-		}
-		if declared {
-			isValid = false
-		} else {
-			isValid = true
-		}
+// checkFunctionEnd reports a function that returns a value but can reach
+// the closing brace at end without returning one, and the code after any
+// return that can never run
+func checkFunctionEnd(funcNode *Node, end Position) {
+	if !blockReturns(funcNode.Body) && funcNode.DType != "VOID" {
+		reportAt(SeverityError, end, "Missing return at the end of "+funcNode.Value+", which returns "+funcNode.DType,
+			noteAt(funcNode.Pos, funcNode.Value+" is declared here"))
+	}
+}
 
-	case "ARRAY_DECL":
-		for i := 0; i < len(root.Declared); i++ {
-			if root.Declared[i].Value == newNode.Value {
-				declared = true
-				break
-			}
-		}
-		for i := 0; i < len(root.Params); i++ {
-			if root.Params[i].Value == newNode.Value {
-				declared = true
-				break
-			}
-		}
-		if declared {
-			isValid = false
-		} else {
-			isValid = true
-		}
-		if declared {
-			isValid = false
-		} else {
-			isValid = true
+// blockReturns tells whether every path through a list of statements
+// returns. A statement after one that always returns is reported as
+// unreachable
+func blockReturns(body []*Node) bool {
+	returns := false
+	for _, statement := range body {
+		if returns {
+			warningAt(spanOf(statement), "Unreachable code after return")
+			return true
 		}
+		returns = statementReturns(statement)
+	}
+	return returns
+}
 
+// statementReturns tells whether every path through a statement returns.
+// An if needs an else, and a switch a default, with every branch returning.
+// A loop can be left with break, so it never counts
+func statementReturns(statement *Node) bool {
+	switch statement.Type {
 	case "RETURN":
-		for i := 0; i < len(root.Declared); i++ {
-			if root.Declared[i].Value == newNode.Value {
-				declared = true
-				break
-			}
-		}
-		for i := 0; i < len(root.Params); i++ {
-			if root.Params[i].Value == newNode.Value {
-				declared = true
-				break
-			}
-		}
-		if !declared {
-			isValid = false
-		} else {
-			isValid = true
-		}
-
-	case "ASSIGN":
-		for i := 0; i < len(root.Declared); i++ {
-			if root.Declared[i].Value == newNode.Left.Value {
-				declared = true
-				break
-			}
-		}
+		return true
 
-		for i := 0; i < len(root.Params); i++ {
-			if root.Params[i].Value == newNode.Left.Value {
-				declared = true
-				break
-			}
+	case "IF_STATEMENT":
+		thenReturns := blockReturns(statement.Body)
+		if statement.Right == nil {
+			return false
 		}
+		return blockReturns(statement.Right.Body) && thenReturns
 
-		if !declared {
-			isValid = false
-		} else {
-			isValid = true
-		}
-	case "IDENTIFIER":
-		for i := 0; i < len(root.Declared); i++ {
-			if root.Declared[i].Value == newNode.Value {
-				declared = true
-				break
-			}
+	case "SWITCH_STATEMENT":
+		returns, hasDefault := true, false
+		for _, switchCase := range statement.Body {
+			hasDefault = hasDefault || switchCase.Type == "DEFAULT"
+			returns = blockReturns(switchCase.Body) && returns
 		}
+		return returns && hasDefault
 
-		for i := 0; i < len(root.Params); i++ {
-			if root.Params[i].Value == newNode.Value {
-				declared = true
-				break
+	case "FOR_LOOP", "WHILE_LOOP", "DO_WHILE_LOOP":
+		// the body is still checked for unreachable code
+		for _, child := range statement.Body {
+			if child.Type == "IF_STATEMENT" {
+				blockReturns(child.Body)
 			}
 		}
-
-		if !declared {
-			isValid = false
-		} else {
-			isValid = true
-		}
-
-	default:
-		isValid = true
-	}
-
-	return isValid
-}
-
-func checkFunctionReturnType(root *Node, returnNode *Node) {
-
-	if root.DType == "void" {
-		fmt.Println("Unexpected return in function "+root.Value+" which is void of returns! Line:", line)
-		os.Exit(3)
-	} else if returnNode.DType != root.DType {
-		//fmt.Println("Returned variable "+returnNode.Value+" in "+root.Value+" does not match function return type! Line:", line)
-		//os.Exit(3)
 	}
 
+	return false
 }
 
-func returnType(root *Node, searchedNode *Node) string {
-	var returnType string
-
-	for _, declared := range root.Declared {
-		if declared.Value == searchedNode.Value {
-			returnType = declared.DType
-			break
-		}
-	}
-
-	for _, params := range root.Params {
-		if params.Value == searchedNode.Value {
-			returnType = params.DType
-			break
-		}
-	}
-
-	return returnType
-
+// declareVariable declares a variable, const or array in the current scope.
+// It takes the new name the symbol gets if it shadows another
+func declareVariable(declNode *Node) {
+	symbol := symbolNode(declNode.Value, declNode.Type, declNode.DType, declNode.Scope, declNode.Pos)
+	symbol.Doc = declNode.Doc
+	declareSymbol(symbol)
+	declNode.Value = symbol.Value
 }
 
-func symbolNode(name string, decltype string, dtype string, scope string) *Node {
+func symbolNode(name string, decltype string, dtype string, scope string, pos Position) *Node {
 	newNode := Node{
 		Type:  decltype,
 		DType: dtype,
 		Value: name,
 		Scope: scope,
+		Pos:   pos,
 	}
 
 	return &newNode
 }
 
-func parseForLoop(tokens []string, root *Node, lineNumber int) *Node {
+func parseForLoop(tokens []Token, root *Node) *Node {
 	var newNode Node
 	openParen := 0
 
 	newNode.Type = "FOR_LOOP"
+	newNode.Pos = tokens[0].Position
 	newNode.DType = "FOR_LOOP"
 	newNode.Value = "for"
 
-	// append declared variables to the for loop so that it has access to them
-	newNode.Declared = append(newNode.Declared, root.Declared...)
-
 	// Expect first open parentheses
-	if tokens[1] != "(" {
-		fmt.Println("Expected \"(\" got " + tokens[1] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+	if tokens[1].Text != "(" {
+		errorAt(tokens[1].Position, "Expected \"(\" got "+tokens[1].Text)
 	} else {
 		openParen++
 	}
 
-	closeParenIndex := slices.Index(tokens, ")")
+	closeParenIndex := indexToken(tokens, ")")
 
 	if closeParenIndex == -1 {
-		fmt.Println("Expected \")\" got " + tokens[2] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+		errorAt(tokens[2].Position, "Expected \")\" got "+tokens[2].Text)
 	} else {
 		openParen--
 	}
 
-	firstStatementEndIndex := slices.Index(tokens, ";") + 1
-	secondStatementEndIndex := slices.Index(tokens[firstStatementEndIndex:], ";") + 1
+	firstStatementEndIndex := indexToken(tokens, ";") + 1
+	secondStatementEndIndex := indexToken(tokens[firstStatementEndIndex:], ";") + 1
 
 	parse(tokens[2:firstStatementEndIndex], &newNode)
-	condition := parseGeneric(tokens[firstStatementEndIndex:firstStatementEndIndex+secondStatementEndIndex-1], line, &newNode)
-	step := parseGeneric(tokens[firstStatementEndIndex+secondStatementEndIndex:len(tokens)-1], line, &newNode)
+	condition := parseGeneric(tokens[firstStatementEndIndex:firstStatementEndIndex+secondStatementEndIndex-1], &newNode)
+	checkCondition(condition, "for")
+	step := parseAssignment(tokens[firstStatementEndIndex+secondStatementEndIndex:len(tokens)-1], &newNode)
 
 	newNode.Params = append(newNode.Params, condition)
 	newNode.Body = append(newNode.Body, step)
@@ -582,46 +551,99 @@ func parseForLoop(tokens []string, root *Node, lineNumber int) *Node {
 	return &newNode
 }
 
-func parseWhile(tokens []string, root *Node, lineNumber int) *Node {
+func parseWhile(tokens []Token, root *Node) *Node {
 	var newNode Node
 	openParen := 0
 
 	newNode.Type = "WHILE_LOOP"
+	newNode.Pos = tokens[0].Position
 	newNode.DType = "WHILE_LOOP"
 	newNode.Value = "while"
 
-	// append declared variables to the for loop so that it has access to them
-	newNode.Declared = append(newNode.Declared, root.Declared...)
-
 	// Expect first open parentheses
-	if tokens[1] != "(" {
-		fmt.Println("Expected \"(\" got " + tokens[1] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+	if tokens[1].Text != "(" {
+		errorAt(tokens[1].Position, "Expected \"(\" got "+tokens[1].Text)
 	} else {
 		openParen++
 	}
 
-	closeParenIndex := slices.Index(tokens, ")")
+	closeParenIndex := findMatchingToken(tokens, 1)
 
 	if closeParenIndex == -1 {
-		fmt.Println("Expected \")\" got " + tokens[2] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+		errorAt(tokens[1].Position, "Missing closing \")\" in while condition")
 	} else {
 		openParen--
 	}
+	if closeParenIndex == 2 {
+		errorAt(tokens[1].Position, "Missing condition in while loop")
+	}
 
-	condition := parseGeneric(tokens[2:closeParenIndex], line, &newNode)
+	condition := parseGeneric(tokens[2:closeParenIndex], &newNode)
+	checkCondition(condition, "while")
 
 	newNode.Params = append(newNode.Params, condition)
 
 	return &newNode
 }
 
+// checkCondition reports the condition of an if or a loop that isn't a bool
+func checkCondition(condition *Node, statement string) {
+	if condition.DType != "BOOL" {
+		errorAt(spanOf(condition), "Condition of "+statement+" must be BOOL, got "+condition.DType)
+	}
+}
+
+// parseDoWhile parses "do { ... } while (condition)" into a DO_WHILE_LOOP,
+// shaped like a WHILE_LOOP but running its body before the first check
+func parseDoWhile(tokens []Token, root *Node) (*Node, int) {
+	newNode := Node{
+		Type:  "DO_WHILE_LOOP",
+		DType: "DO_WHILE_LOOP",
+		Value: "do",
+		Pos:   tokens[0].Position,
+	}
+
+	if len(tokens) < 2 || tokens[1].Text != "{" {
+		errorAt(tokens[0].Position, "Missing '{' after do")
+	}
+	closingBraceIndex := findMatchingBrace(tokens, 1)
+	if closingBraceIndex == -1 {
+		errorAt(tokens[1].Position, "Missing closing '}' for do block")
+	}
+
+	whileIndex := closingBraceIndex + 1
+	if whileIndex >= len(tokens) || tokens[whileIndex].Text != "while" {
+		errorAt(tokens[closingBraceIndex].Position, "Expected while (condition) after do block")
+	}
+	if whileIndex+1 >= len(tokens) || tokens[whileIndex+1].Text != "(" {
+		errorAt(tokens[whileIndex].Position, "Expected \"(\" after while")
+	}
+	closeParenIndex := findMatchingToken(tokens, whileIndex+1)
+	if closeParenIndex == -1 {
+		errorAt(tokens[whileIndex+1].Position, "Missing closing \")\" in while condition")
+	}
+
+	if closeParenIndex == whileIndex+2 {
+		errorAt(tokens[whileIndex+1].Position, "Missing condition in while loop")
+	}
+
+	parseScoped(tokens[2:closingBraceIndex], &newNode, "BLOCK")
+	condition := parseGeneric(tokens[whileIndex+2:closeParenIndex], &newNode)
+	checkCondition(condition, "while")
+	newNode.Params = append(newNode.Params, condition)
+
+	doLoopCore := forLoopIf(&newNode)
+	newNode.Body = []*Node{doLoopCore}
+
+	return &newNode, closeParenIndex + 1
+}
+
 func forLoopIf(node *Node) *Node {
 	ifNode := Node{
 		Type:  "IF_STATEMENT",
 		Value: "if",
 		Body:  []*Node{},
+		Pos:   node.Pos,
 	}
 
 	ifNode.Body = node.Body
@@ -630,30 +652,62 @@ func forLoopIf(node *Node) *Node {
 	return &ifNode
 }
 
-func parseDecl(tokens []string, lineNumber int) *Node {
+func parseDecl(tokens []Token) *Node {
 	newNode := Node{
 		Type:  "DECLARATION",
-		DType: strings.ToUpper(tokens[0]),
-		Value: tokens[1],
+		DType: dataType(tokens[0].Text),
+		Value: tokens[1].Text,
+		Pos:   tokens[1].Position,
 	}
 
-	if !isIdentifier(tokens[1]) {
-		fmt.Println("Expected variable name declaration got " + tokens[1] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+	if !isIdentifier(tokens[1].Text) {
+		errorAt(tokens[1].Position, "Expected variable name declaration got "+tokens[1].Text)
 	}
 	return &newNode
 }
 
-// Parse return declarations
-func parseReturn(tokens []string, lineNumber int, root *Node) *Node {
+// parseConst parses "const type NAME = value" into a CONST_DECL with the
+// value in Right. The optimizer folds the value and inlines it everywhere
+func parseConst(tokens []Token, root *Node) *Node {
+	if len(tokens) < 3 {
+		errorAt(tokens[0].Position, "Expected a type and a name after const")
+	}
+	if !slices.Contains([]string{"int", "string", "char", "float", "bool"}, tokens[1].Text) && !isEnumType(tokens[1].Text) {
+		errorAt(tokens[1].Position, "A const must be an int, string, char, float, bool or enum, got "+tokens[1].Text)
+	}
+
+	newNode := parseDecl(tokens[1:3])
+	newNode.Type = "CONST_DECL"
+
+	if len(tokens) < 5 || tokens[3].Text != "=" {
+		errorAt(newNode.Pos, "Const "+newNode.Value+" needs a value")
+	}
+	newNode.Right = widenTo(parseGeneric(tokens[4:], root), newNode.DType)
+
+	if newNode.Right.DType != newNode.DType {
+		errorAt(spanOf(newNode.Right), "Type mismatch between "+newNode.Value+" ("+newNode.DType+") and "+newNode.Right.Value+" ("+newNode.Right.DType+")")
+	}
+
+	return newNode
+}
 
-	returnNode := parseGeneric(tokens[1:], lineNumber, root)
+// Parse return declarations
+func parseReturn(tokens []Token, root *Node) *Node {
 
 	newNode := Node{
 		Type:  "RETURN",
 		Value: "return",
+		DType: "VOID",
+		Pos:   tokens[0].Position,
+	}
+
+	// a bare return, which only a void function can have
+	if len(tokens) == 1 {
+		return &newNode
 	}
 
+	returnNode := parseGeneric(tokens[1:], root)
+
 	newNode.Body = append(newNode.Body, returnNode)
 	newNode.DType = returnNode.DType
 
@@ -661,32 +715,30 @@ func parseReturn(tokens []string, lineNumber int, root *Node) *Node {
 }
 
 // Parse Function Declarations
-func parseFunc(tokens []string, lineNumber int) *Node {
+func parseFunc(tokens []Token) *Node {
 	var newNode Node
 	openParen := 0
 
 	newNode.Type = "FUNCTION_DECL"
 	newNode.DType = "VOID"
+	newNode.Pos = tokens[1].Position
 
-	if !isIdentifier(tokens[1]) {
-		fmt.Println("Expected function name declaration got " + tokens[1] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+	if !isIdentifier(tokens[1].Text) {
+		errorAt(tokens[1].Position, "Expected function name declaration got "+tokens[1].Text)
 	} else {
-		newNode.Value = tokens[1]
+		newNode.Value = tokens[1].Text
 	}
 
-	if tokens[2] != "(" {
-		fmt.Println("Expected \"(\" got " + tokens[2] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+	if tokens[2].Text != "(" {
+		errorAt(tokens[2].Position, "Expected \"(\" got "+tokens[2].Text)
 	} else {
 		openParen++
 	}
 
-	closeParenIndex := slices.Index(tokens, ")")
+	closeParenIndex := indexToken(tokens, ")")
 
 	if closeParenIndex == -1 {
-		fmt.Println("Expected \")\" got " + tokens[2] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+		errorAt(tokens[2].Position, "Expected \")\" got "+tokens[2].Text)
 	} else {
 		openParen--
 	}
@@ -695,247 +747,776 @@ func parseFunc(tokens []string, lineNumber int) *Node {
 		params := tokens[2:closeParenIndex]
 
 		for i := 1; i < (len(params) + 1); i += 3 {
-			newNode.Params = append(newNode.Params, parseDecl(params[i:i+2], lineNumber))
+			newNode.Params = append(newNode.Params, parseDecl(params[i:i+2]))
 		}
 	}
 
-	if isIdentifier(tokens[closeParenIndex+1]) {
-		newNode.DType = strings.ToUpper(tokens[closeParenIndex+1])
-	} else if tokens[closeParenIndex+1] != "{" {
-		fmt.Println("Expected \"{\" got " + tokens[closeParenIndex+1] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+	if isIdentifier(tokens[closeParenIndex+1].Text) {
+		newNode.DType = dataType(tokens[closeParenIndex+1].Text)
+	} else if tokens[closeParenIndex+1].Text != "{" {
+		errorAt(tokens[closeParenIndex+1].Position, "Expected \"{\" got "+tokens[closeParenIndex+1].Text)
 	}
 
 	return &newNode
 
 }
 
-func parseArrayIndex(tokens []string, lineNumber int, root *Node) Node {
-	arrayNode := Node{}
-
-	arrayNode.Type = "ARRAY_INDEX"
-
-	indexStart := slices.Index(tokens, "[")
+// parseArrayIndex parses "a[i]" or "m[i][j]" into an ARRAY_INDEX with the
+// array in Left and an index per dimension in Body. Giving fewer indexes
+// than the array has dimensions picks a whole row
+func parseArrayIndex(tokens []Token, root *Node) Node {
+	arrayNode := Node{
+		Type:  "ARRAY_INDEX",
+		Value: tokens[0].Text,
+		Pos:   tokens[0].Position,
+	}
 
-	arrayNode.Value = strings.Join(tokens[:indexStart], "")
+	array := parseIdentifier(tokens[0], root)
+	if !isArrayType(array.DType) {
+		errorAt(array.Pos, array.Value+" ("+array.DType+") is not an array")
+	}
+	arrayNode.Value = array.Value
+	arrayNode.Left = array
 
-	indexTokens := tokens[indexStart+1 : len(tokens)-1]
+	dtype := array.DType
+	for i := 1; i < len(tokens); {
+		closeIndex := findMatchingToken(tokens, i)
+		if !isArrayType(dtype) {
+			errorAt(tokens[i].Position, "Too many indexes for "+array.Value+" ("+array.DType+")")
+		}
+		if closeIndex == i+1 {
+			errorAt(tokens[i].Position, "Expected an index inside \"[]\"")
+		}
 
-	arrayNode.Body = append(arrayNode.Body, parseGeneric(indexTokens, lineNumber, root))
+		arrayIndex := parseGeneric(tokens[i+1:closeIndex], root)
+		if arrayIndex.DType != "INT" {
+			errorAt(spanOf(arrayIndex), "Array index must be an INT, got "+arrayIndex.DType)
+		}
+		checkArrayIndex(arrayIndex, arrayIndex, array.Value, arrayLength(dtype))
 
-	arrayNode.DType = returnType(root, &arrayNode)[2:]
+		arrayNode.Body = append(arrayNode.Body, arrayIndex)
+		dtype = elementType(dtype)
+		i = closeIndex + 1
+	}
+	arrayNode.DType = dtype
 
 	return arrayNode
 }
 
-func parseArray(tokens []string, lineNumber int, root *Node) Node {
+// checkArrayIndex reports an index whose value is known to be outside an
+// array dimension of the given length. value is the index once folded
+func checkArrayIndex(arrayIndex *Node, value *Node, name string, length int) {
+	if position, known := intValue(value); known && (position < 0 || position >= length) {
+		errorAt(spanOf(arrayIndex), fmt.Sprintf("Index %d is out of range for %s (length %d)", position, name, length))
+	}
+}
+
+func parseArray(tokens []Token, root *Node) Node {
 
 	newNode := Node{
 		Type:  "ARRAY",
 		Value: "{}",
+		Pos:   tokens[0].Position,
 	}
 
 	// Expect the second token to be an opening parenthesis
-	if tokens[0] != "{" {
-		fmt.Println("Expected \"{\" after function name, got " + tokens[0] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+	if tokens[0].Text != "{" {
+		errorAt(tokens[0].Position, "Expected \"{\" after function name, got "+tokens[0].Text)
 	}
 
 	// Find the closing parenthesis
-	closeBracketIndex := slices.Index(tokens, "}")
+	closeBracketIndex := findMatchingToken(tokens, 0)
 	if closeBracketIndex == -1 {
-		fmt.Println("Expected \"}\" to close function call on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+		errorAt(tokens[0].Position, "Expected \"}\" to close function call")
 	}
 
 	// Extract the arguments between brackets
 	args := tokens[1:closeBracketIndex]
 
 	// Parse each element
-	for i := 0; i < (len(args)); i += 2 {
-		if args[i] == "," {
-			fmt.Println("Unexpected character \"" + args[i] + "\" in array setting on line " + strconv.Itoa(lineNumber))
-			os.Exit(3)
-		} else {
-			newNode.Body = append(newNode.Body, parseGeneric(args[i:i+1], lineNumber, root))
+	for _, element := range splitArguments(args) {
+		if len(element) == 0 {
+			errorAt(newNode.Pos, "Unexpected character \",\" in array setting")
 		}
+		newNode.Body = append(newNode.Body, parseGeneric(element, root))
 	}
 
 	return newNode
 }
 
-func parseWrite(tokens []string, lineNumber int, root *Node) Node {
+// parseStructLiteral parses "Point{1, 2}" or "Point{x: 1, y: 2}" into a
+// STRUCT_LITERAL with the value of every field in Params, in declaration
+// order. Fields left out are zero
+func parseStructLiteral(tokens []Token, root *Node) *Node {
+	structNode := findStruct(tokens[0].Text)
+
+	newNode := Node{
+		Type:   "STRUCT_LITERAL",
+		DType:  structNode.Value,
+		Value:  structNode.Value,
+		Params: make([]*Node, len(structNode.Params)),
+		Pos:    tokens[0].Position,
+	}
+
+	// the values may be spread over several lines
+	var values []Token
+	for _, token := range tokens[2 : len(tokens)-1] {
+		if token.Text != "\n" {
+			values = append(values, token)
+		}
+	}
+
+	named := false
+	for valueIndex, value := range splitArguments(values) {
+		if len(value) == 0 {
+			errorAt(newNode.Pos, "Unexpected character \",\" in struct literal")
+		}
+
+		isNamed := len(value) > 2 && value[0].Kind == "IDENTIFIER" && value[1].Text == ":"
+		if valueIndex == 0 {
+			named = isNamed
+		} else if isNamed != named {
+			errorAt(value[0].Position, "Struct literal mixes named and positional fields")
+		}
+
+		fieldIndex := valueIndex
+		if named {
+			fieldIndex = slices.IndexFunc(structNode.Params, func(field *Node) bool {
+				return field.Value == value[0].Text
+			})
+			if fieldIndex == -1 {
+				errorAt(value[0].Position, "Struct "+structNode.Value+" has no field "+value[0].Text)
+			}
+			if newNode.Params[fieldIndex] != nil {
+				errorAt(value[0].Position, "Field "+value[0].Text+" is given twice")
+			}
+			value = value[2:]
+		} else if fieldIndex >= len(structNode.Params) {
+			errorAt(value[0].Position, fmt.Sprintf("Too many values for struct %s, it has %d fields", structNode.Value, len(structNode.Params)))
+		}
+
+		field := structNode.Params[fieldIndex]
+		fieldValue := widenTo(parseGeneric(value, root), field.DType)
+		if fieldValue.DType != field.DType {
+			errorAt(spanOf(fieldValue), "Field "+field.Value+" of "+structNode.Value+" is "+field.DType+", got "+fieldValue.Value+" ("+fieldValue.DType+")")
+		}
+		newNode.Params[fieldIndex] = fieldValue
+	}
+
+	for fieldIndex, field := range structNode.Params {
+		if newNode.Params[fieldIndex] == nil {
+			newNode.Params[fieldIndex] = zeroValue(field.DType, newNode.Pos)
+		}
+	}
+
+	return &newNode
+}
+
+func parseWrite(tokens []Token, root *Node) Node {
 	newNode := Node{
 		Type:  "FUNCTION_CALL",
-		Value: tokens[0], // The function name (e.g., 'write')
+		Value: tokens[0].Text, // The function name (e.g., 'write')
+		Pos:   tokens[0].Position,
 	}
 
 	// Expect the second token to be an opening parenthesis
-	if tokens[1] != "(" {
-		fmt.Println("Expected \"(\" after function name, got " + tokens[1] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+	if tokens[1].Text != "(" {
+		errorAt(tokens[1].Position, "Expected \"(\" after function name, got "+tokens[1].Text)
 	}
 
 	// Find the closing parenthesis
-	closeParenIndex := slices.Index(tokens, ")")
+	closeParenIndex := findMatchingToken(tokens, 1)
 	if closeParenIndex == -1 {
-		fmt.Println("Expected \")\" to close function call on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+		errorAt(tokens[0].Position, "Expected \")\" to close function call")
 	}
 
 	// Extract the arguments between parentheses
-	args := tokens[2:closeParenIndex]
+	args := splitArguments(tokens[2:closeParenIndex])
 
 	// Parse each argument and add it to the function's Params
 
-	if len(args) > 1 {
-		fmt.Println("Unexpected character \"" + args[0] + "\" in parameters call on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+	if len(args) != 1 {
+		errorAt(tokens[1].Position, "write takes exactly one argument")
 	} else {
-		newNode.Params = append(newNode.Params, parseGeneric(args[0:1], lineNumber, root))
+		newNode.Params = append(newNode.Params, parseGeneric(args[0], root))
+	}
+
+	if value := newNode.Params[0]; isStructType(value.DType) {
+		errorAt(spanOf(value), "Cannot write "+value.Value+" ("+value.DType+"), write its fields instead")
+	} else if isArrayValue(value) {
+		errorAt(spanOf(value), "Cannot write a whole array, write its elements instead")
 	}
 
 	return newNode
 }
 
-func parseFunctionCall(tokens []string, lineNumber int, root *Node) Node {
+// parseLen parses "len(a)" into the length of the array a as an INT
+// literal, since the length of every array is known at compile time
+func parseLen(tokens []Token, root *Node) *Node {
+	args := splitArguments(tokens[2 : len(tokens)-1])
+	if len(args) != 1 {
+		errorAt(tokens[1].Position, "len takes exactly one argument")
+	}
+
+	array := parseGeneric(args[0], root)
+	if !isArrayType(array.DType) {
+		errorAt(spanOf(array), "Cannot take len of "+array.Value+" ("+array.DType+"), only of an array")
+	}
+
+	pos := tokens[0].Position
+	if last := tokens[len(tokens)-1]; last.Line == pos.Line {
+		pos.Len = last.Col + last.Len - pos.Col
+	}
+	return &Node{Type: "INT", DType: "INT", Value: strconv.Itoa(arrayLength(array.DType)), Pos: pos}
+}
+
+func parseFunctionCall(tokens []Token, root *Node) Node {
 	// Special case - skip if it's an else statement
-	if tokens[0] == "else" {
+	if tokens[0].Text == "else" {
 		return Node{} // Return empty node which will be handled by the if statement parsing
 	}
 
 	newNode := Node{
 		Type:  "FUNCTION_CALL",
-		Value: tokens[0],
+		Value: tokens[0].Text,
+		Pos:   tokens[0].Position,
 	}
 
-	functionDeclared := false
-
-	// Check if this is a built-in function
-	if tokens[0] == "write" {
-		functionDeclared = true
-	} else {
-		// Check if the function has been declared
+	// write is built in, every other function has to be declared
+	var callee *Node
+	if tokens[0].Text != "write" {
 		for _, declared := range DeclaredFunctions.Body {
 			if declared.Value == newNode.Value {
 				newNode.DType = declared.DType
-				functionDeclared = true
+				callee = declared
 				break
 			}
 		}
-	}
 
-	if !functionDeclared {
-		fmt.Println("Unrecognized function \""+newNode.Value+"\" Line:", line)
-		os.Exit(3)
+		if callee == nil {
+			errorAt(newNode.Pos, "Unrecognized function \""+newNode.Value+"\"")
+		}
 	}
 
 	// Rest of the function remains the same
-	if tokens[1] != "(" {
-		fmt.Println("Expected \"(\" after function name, got " + tokens[1] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+	if tokens[1].Text != "(" {
+		errorAt(tokens[1].Position, "Expected \"(\" after function name, got "+tokens[1].Text)
 	}
 
-	closeParenIndex := slices.Index(tokens, ")")
+	closeParenIndex := findMatchingToken(tokens, 1)
 	if closeParenIndex == -1 {
-		fmt.Println("Expected \")\" to close function call on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+		errorAt(tokens[0].Position, "Expected \")\" to close function call")
 	}
 
 	args := tokens[2:closeParenIndex]
 
-	var currentChunk []string
-
-	for i := 0; i < len(args); i++ {
-		if args[i] == "," {
-			// If we encounter a ",", process the current chunk
-			if len(currentChunk) > 0 {
-				newNode.Params = append(newNode.Params, parseGeneric(currentChunk, lineNumber, root))
-				currentChunk = nil // Reset the chunk
-			}
-		} else {
-			// Add token to the current chunk
-			currentChunk = append(currentChunk, args[i])
-		}
+	// Parse each comma separated argument
+	for _, arg := range splitArguments(args) {
+		newNode.Params = append(newNode.Params, parseGeneric(arg, root))
 	}
 
-	// Process the final chunk if any
-	if len(currentChunk) > 0 {
-		newNode.Params = append(newNode.Params, parseGeneric(currentChunk, lineNumber, root))
+	if callee != nil {
+		callPos := newNode.Pos
+		if closeParen := tokens[closeParenIndex]; closeParen.Line == callPos.Line {
+			callPos.Len = closeParen.Col + closeParen.Len - callPos.Col
+		}
+		checkArguments(callee, &newNode, callPos)
 	}
 
 	return newNode
 }
 
-func parseArrayDecl(tokens []string, lineNumber int) *Node {
-	newNode := Node{
-		Type:  "ARRAY_DECL",
-		DType: strings.ToUpper(strings.Join(tokens[0:3], "")),
-		Value: tokens[3],
-	}
+// checkArguments checks the arguments of a call against the params of the
+// function called. A number is promoted to the type of its param like in an
+// assignment, anything else has to match it
+func checkArguments(callee *Node, call *Node, callPos Position) {
+	declared := noteAt(callee.Pos, callee.Value+" is declared here")
 
-	if !isIdentifier(tokens[3]) {
-		fmt.Println("Expected variable name declaration got " + tokens[3] + " on line " + strconv.Itoa(lineNumber))
-		os.Exit(3)
+	if len(call.Params) < len(callee.Params) {
+		var missing []string
+		for _, param := range callee.Params[len(call.Params):] {
+			missing = append(missing, sourceName(param.Value)+" ("+param.DType+")")
+		}
+		errorAt(callPos, fmt.Sprintf("Too few arguments to %s: it takes %d, got %d, missing %s", callee.Value, len(callee.Params), len(call.Params), strings.Join(missing, ", ")), declared)
+	}
+	if len(call.Params) > len(callee.Params) {
+		errorAt(spanOf(call.Params[len(callee.Params)]), fmt.Sprintf("Too many arguments to %s: it takes %d, got %d", callee.Value, len(callee.Params), len(call.Params)), declared)
 	}
 
-	return &newNode
-}
+	for index, param := range callee.Params {
+		arg := call.Params[index]
+		if promotedType(arg.DType, param.DType) == param.DType {
+			arg = promote(arg, param.DType)
+		}
 
-// Validates identifiers (variable names, function names, etc.)
-func isIdentifier(word string) bool {
-	validIdentifier := regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
-	return validIdentifier.MatchString(word)
+		if arg.DType != param.DType {
+			message := "Parameter " + sourceName(param.Value) + " of " + callee.Value + " is " + param.DType + ", got " + describeValue(arg)
+			// a narrower param needs an explicit conversion
+			if promotedType(arg.DType, param.DType) != "" {
+				message += ", convert it with " + strings.ToLower(param.DType) + "()"
+			}
+			errorAt(spanOf(arg), message, noteAt(param.Pos, sourceName(param.Value)+" is declared here"))
+		}
+		call.Params[index] = arg
+	}
 }
 
-// SplitStringInPlace splits mixed strings (like "add(int" or "b)") in the array in place
-func splitStringInPlace(arr *[]string) {
-	// Updated regex pattern:
-	// 1. Matches quoted strings: "..." or '...'
-	// 2. Matches decimal numbers as a single token (e.g., 123.45)
-	// 3. Matches multi-character operators like ==, >=, <=, and //
-	// 4. Matches single-character operators, symbols, and identifiers
-	pattern := regexp.MustCompile(`"[^"]*"|'[^']*'|\b\d+\.\d+\b|==|>=|<=|//|[a-zA-Z0-9]+|[(){}[\];,+\-*/%=<>!]`)
-	var result []string
+// parseStruct parses "struct Name { type field; ... }", its fields split by
+// newlines or ";", into a STRUCT_DECL
+func parseStruct(tokens []Token, root *Node) (*Node, int) {
+	if root.Type != "" {
+		errorAt(tokens[0].Position, "Structs can only be declared at the top level")
+	}
+	if len(tokens) < 2 || tokens[1].Kind != "IDENTIFIER" {
+		errorAt(tokens[0].Position, "Expected struct name after struct")
+	}
 
-	for _, str := range *arr {
-		// Find all matches based on the regex pattern
-		matches := pattern.FindAllString(str, -1)
-		// Append the split matches to the result array
-		result = append(result, matches...)
+	newNode := Node{
+		Type:  "STRUCT_DECL",
+		DType: tokens[1].Text,
+		Value: tokens[1].Text,
+		Pos:   tokens[1].Position,
+	}
+
+	if previous := findStruct(newNode.Value); previous != nil {
+		errorAt(newNode.Pos, "Struct "+newNode.Value+" has already been declared!", noteAt(previous.Pos, "previous declaration of "+newNode.Value+" is here"))
+	}
+
+	if len(tokens) < 3 || tokens[2].Text != "{" {
+		errorAt(tokens[1].Position, "Missing '{' after struct "+newNode.Value)
+	}
+	closingBraceIndex := findMatchingBrace(tokens, 2)
+	if closingBraceIndex == -1 {
+		errorAt(tokens[2].Position, "Missing closing '}' for struct "+newNode.Value)
+	}
+
+	fieldLines := 0
+	fieldStart := 3
+	for j := 3; j <= closingBraceIndex; j++ {
+		if j < closingBraceIndex && tokens[j].Text != "\n" && tokens[j].Text != ";" {
+			continue
+		}
+		if j > fieldStart {
+			fieldLines++
+			if field := parseStructField(tokens[fieldStart:j], &newNode); field != nil {
+				newNode.Params = append(newNode.Params, field)
+			}
+		}
+		fieldStart = j + 1
 	}
 
-	// Replace the original array content with the new split elements
-	*arr = result
+	if fieldLines == 0 {
+		reportAt(SeverityError, newNode.Pos, "Struct "+newNode.Value+" has no fields")
+	}
+
+	return &newNode, closingBraceIndex + 1
+}
+
+// parseStructField parses one "type name" field of a struct, or reports it
+// and returns nil
+func parseStructField(tokens []Token, structNode *Node) *Node {
+	if len(tokens) != 2 || !isIdentifier(tokens[1].Text) {
+		reportAt(SeverityError, tokens[0].Position, "Expected a field as \"type name\" in struct "+structNode.Value)
+		return nil
+	}
+
+	switch typeName := tokens[0].Text; {
+	case typeName == structNode.Value:
+		reportAt(SeverityError, tokens[0].Position, "Struct "+structNode.Value+" cannot contain itself")
+		return nil
+	case !slices.Contains([]string{"int", "string", "char", "float", "bool"}, typeName) && !isStructType(typeName) && !isEnumType(typeName):
+		reportAt(SeverityError, tokens[0].Position, "Unknown type "+typeName+" for field "+tokens[1].Text)
+		return nil
+	}
+
+	field := parseDecl(tokens)
+	if previous := structField(structNode, field.Value); previous != nil {
+		reportAt(SeverityError, field.Pos, "Duplicate field "+field.Value+" in struct "+structNode.Value, noteAt(previous.Pos, "first declared here"))
+		return nil
+	}
+	return field
+}
+
+// findStruct returns the declaration of a struct type, or nil
+func findStruct(name string) *Node {
+	for _, declared := range DeclaredStructs.Body {
+		if declared.Value == name {
+			return declared
+		}
+	}
+	return nil
+}
+
+func isStructType(dtype string) bool {
+	return findStruct(dtype) != nil
 }
 
-// RemoveComments removes everything from // (inclusive) to \n in the array of strings
-func removeComments(arr *[]string) {
-	var result []string
-	skip := false // Flag to indicate whether we are skipping tokens within a comment
+// structField returns the field of a struct declaration with the given name, or nil
+func structField(structNode *Node, name string) *Node {
+	for _, field := range structNode.Params {
+		if field.Value == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// dataType is the DType a type name stands for. Struct and enum types keep their name
+func dataType(typeName string) string {
+	if isStructType(typeName) || isEnumType(typeName) {
+		return typeName
+	}
+	return strings.ToUpper(typeName)
+}
+
+// declareFields declares every field of a struct variable, nested ones
+// included, as a symbol named "p.x"
+func declareFields(variable *Node, scope string) {
+	structNode := findStruct(variable.DType)
+	if structNode == nil {
+		return
+	}
+
+	// the variable was just declared, so its fields can't clash with anything
+	for _, field := range structNode.Params {
+		fieldSymbol := symbolNode(variable.Value+"."+field.Value, field.Type, field.DType, scope, variable.Pos)
+		currentScope.Symbols[fieldSymbol.Value] = fieldSymbol
+		declareFields(fieldSymbol, scope)
+	}
+}
+
+// declareStruct declares the fields of a struct variable. It returns the
+// STRUCT_VAR laying the variable out and, without an initializer, its
+// zeroing
+func declareStruct(declNode *Node, initialized bool) []*Node {
+	if !isStructType(declNode.DType) {
+		return nil
+	}
+
+	declareFields(declNode, declNode.Scope)
+
+	statements := []*Node{structVariable(declNode)}
+	if !initialized {
+		statements = append(statements, &Node{
+			Type:  "ASSIGN",
+			DType: "OP",
+			Value: "=",
+			Left:  &Node{Type: "IDENTIFIER", Value: declNode.Value, DType: declNode.DType, Pos: declNode.Pos},
+			Right: zeroValue(declNode.DType, declNode.Pos),
+			Pos:   declNode.Pos,
+		})
+	}
+	return statements
+}
+
+// structVariable is the STRUCT_VAR giving the fields of a struct variable
+// their place in memory
+func structVariable(variable *Node) *Node {
+	return &Node{
+		Type:  "STRUCT_VAR",
+		DType: variable.DType,
+		Value: variable.Value,
+		Pos:   variable.Pos,
+	}
+}
+
+// structLeaves lists the scalar variables a struct variable is made of, as
+// "p.x" identifiers. Nested structs are flattened in field order
+func structLeaves(name string, dtype string, pos Position) []*Node {
+	structNode := findStruct(dtype)
+	if structNode == nil {
+		return []*Node{{Type: "IDENTIFIER", Value: name, DType: dtype, Pos: pos}}
+	}
+
+	var leaves []*Node
+	for _, field := range structNode.Params {
+		leaves = append(leaves, structLeaves(name+"."+field.Value, field.DType, pos)...)
+	}
+	return leaves
+}
+
+// zeroValue is the literal a variable of the given type starts out as
+func zeroValue(dtype string, pos Position) *Node {
+	zero := map[string]string{"INT": "0", "FLOAT": "0.0", "CHAR": "'\x00'", "STRING": "\"\"", "BOOL": "False"}
+	if value, exists := zero[dtype]; exists {
+		return &Node{Type: dtype, DType: dtype, Value: value, Pos: pos}
+	}
+
+	// an enum starts as its first member
+	if enumNode := findEnum(dtype); enumNode != nil {
+		return enumValue(enumNode.Params[0], pos)
+	}
+
+	structNode := findStruct(dtype)
+	literal := &Node{Type: "STRUCT_LITERAL", DType: dtype, Value: dtype, Pos: pos}
+	for _, field := range structNode.Params {
+		literal.Params = append(literal.Params, zeroValue(field.DType, pos))
+	}
+	return literal
+}
+
+// parseEnum parses "enum Name { A, B = 5, C }" into an ENUM_DECL. A member
+// without a value is one more than the member before it, the first one 0
+func parseEnum(tokens []Token, root *Node) (*Node, int) {
+	if root.Type != "" {
+		errorAt(tokens[0].Position, "Enums can only be declared at the top level")
+	}
+	if len(tokens) < 2 || tokens[1].Kind != "IDENTIFIER" {
+		errorAt(tokens[0].Position, "Expected enum name after enum")
+	}
+
+	newNode := Node{
+		Type:  "ENUM_DECL",
+		DType: tokens[1].Text,
+		Value: tokens[1].Text,
+		Pos:   tokens[1].Position,
+	}
+
+	if previous := lookupSymbol(newNode.Value); previous != nil || isStructType(newNode.Value) || isEnumType(newNode.Value) {
+		errorAt(newNode.Pos, newNode.Value+" has already been declared!")
+	}
+
+	if len(tokens) < 3 || tokens[2].Text != "{" {
+		errorAt(tokens[1].Position, "Missing '{' after enum "+newNode.Value)
+	}
+	closingBraceIndex := findMatchingBrace(tokens, 2)
+	if closingBraceIndex == -1 {
+		errorAt(tokens[2].Position, "Missing closing '}' for enum "+newNode.Value)
+	}
+
+	// members may be spread over several lines
+	var memberTokens []Token
+	for _, token := range tokens[3:closingBraceIndex] {
+		if token.Text != "\n" {
+			memberTokens = append(memberTokens, token)
+		}
+	}
+
+	next := 0
+	usedValues := map[int]*Node{}
+	for _, member := range splitArguments(memberTokens) {
+		if len(member) == 0 || member[0].Kind != "IDENTIFIER" {
+			reportAt(SeverityError, newNode.Pos, "Expected a member name in enum "+newNode.Value)
+			continue
+		}
+
+		memberNode := &Node{
+			Type:  "ENUM_MEMBER",
+			DType: newNode.Value,
+			Value: member[0].Text,
+			Pos:   member[0].Position,
+		}
 
-	for _, str := range *arr {
-		// Check for the start of a comment
-		if str == "//" {
-			skip = true // Start skipping until we hit \n
+		if len(member) > 1 {
+			if member[1].Text != "=" || len(member) == 2 {
+				reportAt(SeverityError, member[1].Position, "Expected \"= value\" after enum member "+memberNode.Value)
+				continue
+			}
+			value := parseGeneric(member[2:], root)
+			if value.Type != "INT" {
+				reportAt(SeverityError, spanOf(value), "Value of enum member "+memberNode.Value+" must be an int literal")
+				continue
+			}
+			next = atoi(value.Value)
+		}
+
+		if previous := lookupSymbol(memberNode.Value); previous != nil {
+			reportAt(SeverityError, memberNode.Pos, memberNode.Value+" has already been declared!", noteAt(previous.Pos, "previous declaration of "+memberNode.Value+" is here"))
 			continue
 		}
+		if previous, used := usedValues[next]; used {
+			reportAt(SeverityError, memberNode.Pos, fmt.Sprintf("Enum value %d of %s is already used by %s", next, memberNode.Value, previous.Value), noteAt(previous.Pos, previous.Value+" is here"))
+			continue
+		}
+
+		memberNode.Left = &Node{Type: "INT", DType: newNode.Value, Value: strconv.Itoa(next)}
+		checkIntRange(memberNode.Left)
+		usedValues[next] = memberNode
+		next++
+
+		newNode.Params = append(newNode.Params, memberNode)
+		declareSymbol(symbolNode(memberNode.Value, memberNode.Type, memberNode.DType, "GLOBAL", memberNode.Pos))
+	}
+
+	if len(newNode.Params) == 0 {
+		errorAt(newNode.Pos, "Enum "+newNode.Value+" has no members")
+	}
+
+	return &newNode, closingBraceIndex + 1
+}
 
-		// If we encounter a newline, stop skipping and include the newline
-		if str == "\n" {
-			skip = false
-			result = append(result, str)
+// findEnum returns the declaration of an enum type, or nil
+func findEnum(name string) *Node {
+	for _, declared := range DeclaredEnums.Body {
+		if declared.Value == name {
+			return declared
+		}
+	}
+	return nil
+}
+
+func isEnumType(dtype string) bool {
+	return findEnum(dtype) != nil
+}
+
+// enumMember returns the member of an enum declaration with the given name, or nil
+func enumMember(enumNode *Node, name string) *Node {
+	for _, member := range enumNode.Params {
+		if member.Value == name {
+			return member
+		}
+	}
+	return nil
+}
+
+// enumValue is an enum member used as a value: an int typed as its enum
+func enumValue(member *Node, pos Position) *Node {
+	value := *member.Left
+	value.Pos = pos
+	return &value
+}
+
+// parseArrayDecl parses the type and name of "[3]int a" or "[2][3]int m".
+// The DType lists every dimension before the element type, like
+// "[2][3]INT", and starts with "[]" when the length is left to the literal.
+// It also returns the index of the name
+func parseArrayDecl(tokens []Token) (*Node, int) {
+	dtype := ""
+	i := 0
+	for i < len(tokens) && tokens[i].Text == "[" {
+		if i+1 < len(tokens) && tokens[i+1].Text == "]" {
+			if i > 0 {
+				errorAt(tokens[i].Position, "Only the first dimension of an array can take its length from the literal")
+			}
+			dtype += "[]"
+			i += 2
 			continue
 		}
 
-		// If we're not in a comment, include the current token
-		if !skip {
-			result = append(result, str)
+		if i+2 >= len(tokens) || tokens[i+2].Text != "]" {
+			errorAt(tokens[i].Position, "Expected an array length and \"]\"")
+		}
+		if tokens[i+1].Kind != "INT" {
+			errorAt(tokens[i+1].Position, "Array length must be an int literal, got "+tokens[i+1].Text)
+		}
+		length, err := strconv.Atoi(tokens[i+1].Text)
+		if err != nil || length <= 0 {
+			errorAt(tokens[i+1].Position, "Array length must be positive, got "+tokens[i+1].Text)
 		}
+		dtype += "[" + strconv.Itoa(length) + "]"
+		i += 3
+	}
+
+	if i+1 >= len(tokens) {
+		errorAt(tokens[0].Position, "Expected an element type and a name after the array length")
+	}
+	if isStructType(tokens[i].Text) {
+		errorAt(tokens[i].Position, "Arrays of structs are not supported")
+	}
+	if !slices.Contains([]string{"int", "string", "char", "float", "bool"}, tokens[i].Text) && !isEnumType(tokens[i].Text) {
+		errorAt(tokens[i].Position, "Expected an element type after the array length, got "+tokens[i].Text)
 	}
 
-	// Replace the original array content with the filtered array
-	*arr = result
+	newNode := Node{
+		Type:  "ARRAY_DECL",
+		DType: dtype + dataType(tokens[i].Text),
+		Value: tokens[i+1].Text,
+		Pos:   tokens[i+1].Position,
+	}
+
+	if !isIdentifier(tokens[i+1].Text) {
+		errorAt(tokens[i+1].Position, "Expected variable name declaration got "+tokens[i+1].Text)
+	}
+
+	return &newNode, i + 1
+}
+
+// declareArray declares an array from its declaration line. It returns the
+// ARRAY_VAR laying the array out and zeroing it, which carries the doc
+// comment of a global, then the assignment of its value if it has one
+func declareArray(root *Node, tokens []Token, scope string, doc string) []*Node {
+	declNode, nameIndex := parseArrayDecl(tokens)
+
+	var value *Node
+	if len(tokens) > nameIndex+1 {
+		if tokens[nameIndex+1].Text != "=" || len(tokens) == nameIndex+2 {
+			errorAt(tokens[nameIndex+1].Position, "Expected \"= value\" after "+declNode.Value)
+		}
+		value = parseGeneric(tokens[nameIndex+2:], root)
+
+		// "[]" takes its length from the literal
+		if strings.HasPrefix(declNode.DType, "[]") {
+			if value.Type != "ARRAY" {
+				errorAt(spanOf(value), "Array "+declNode.Value+" is declared with \"[]\", its value must be a literal to take the length from")
+			}
+			declNode.DType = "[" + strconv.Itoa(len(value.Body)) + "]" + declNode.DType[2:]
+		}
+	} else if strings.HasPrefix(declNode.DType, "[]") {
+		errorAt(declNode.Pos, "Array "+declNode.Value+" is declared with \"[]\", it needs a literal to take the length from")
+	}
+
+	declNode.Scope = scope
+	declNode.Doc = doc
+	declareVariable(declNode)
+
+	statements := []*Node{{
+		Type:  "ARRAY_VAR",
+		DType: declNode.DType,
+		Value: declNode.Value,
+		Pos:   declNode.Pos,
+		Doc:   doc,
+	}}
+	if value != nil {
+		target := &Node{Type: "IDENTIFIER", Value: declNode.Value, DType: declNode.DType, Pos: declNode.Pos}
+		statements = append(statements, binaryNode(binaryOperators["="], tokens[nameIndex+1], target, value, root))
+	}
+	return statements
+}
+
+// isArrayType reports an array DType, like "[3]INT"
+func isArrayType(dtype string) bool {
+	return strings.HasPrefix(dtype, "[")
+}
+
+// isArrayValue reports an array variable, row or literal
+func isArrayValue(node *Node) bool {
+	return isArrayType(node.DType) || node.Type == "ARRAY"
+}
+
+// arrayLength is the length of the first dimension of an array type
+func arrayLength(dtype string) int {
+	length, _ := strconv.Atoi(dtype[1:strings.Index(dtype, "]")])
+	return length
+}
+
+// elementType is the type of the elements of an array type: a row for all
+// but the last dimension
+func elementType(dtype string) string {
+	return dtype[strings.Index(dtype, "]")+1:]
+}
+
+// scalarType is the type of the values an array is made of, its last dimension's elements
+func scalarType(dtype string) string {
+	for isArrayType(dtype) {
+		dtype = elementType(dtype)
+	}
+	return dtype
+}
+
+// arraySize is how many values of its scalar type an array type holds, across every dimension
+func arraySize(dtype string) int {
+	size := 1
+	for isArrayType(dtype) {
+		size *= arrayLength(dtype)
+		dtype = elementType(dtype)
+	}
+	return size
+}
+
+// Validates identifiers (variable names, function names, etc.)
+func isIdentifier(word string) bool {
+	validIdentifier := regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	return validIdentifier.MatchString(word)
 }
 
 func traverseAST(root []*Node) {
@@ -959,6 +1540,10 @@ func printNode(node *Node, prefix string, isTail bool) {
 		newPrefix += "│   " // For other children, continue the branch
 	}
 
+	if node.Doc != "" {
+		fmt.Printf("%sDoc: %q\n", newPrefix, node.Doc)
+	}
+
 	// Handle Params, if any
 	if len(node.Params) > 0 {
 		fmt.Println(newPrefix + "Params:")
@@ -994,75 +1579,58 @@ func getBranch(isTail bool) string {
 	return "├── "
 }
 
-func findEndLine(chunk []string) int {
+func findEndLine(chunk []Token) int {
 	bracketCount := 0
+	parenCount := 0
 
 	for i, token := range chunk {
-		switch token {
+		switch token.Text {
 		case "{":
 			bracketCount++
 		case "}":
+			// a block, or a literal like "Point{1, 2}", goes on to the end of its line
 			bracketCount--
-			if bracketCount == 0 {
-				return i
-			}
+		case "(":
+			parenCount++
+		case ")":
+			parenCount--
 		case "\n":
 			if bracketCount == 0 {
 				return i
 			}
 		case ";":
-			if bracketCount == 0 {
+			// the ";"s of a for loop header don't end it
+			if bracketCount == 0 && parenCount <= 0 {
 				return i
 			}
 		}
 	}
 
-	// If we're still in a block, return the length of the chunk
-	if bracketCount > 0 {
-		return len(chunk)
-	}
-
-	return 0
+	// If we're still in a block (or the file ends without a newline),
+	// the statement runs to the end of the chunk
+	return len(chunk)
 }
 
-func bisect(expression []string, character string, direction string) []string {
-	index := slices.Index(expression, character)
-
-	// Check if character is not found
-	if index == -1 {
-		fmt.Println("Character not found in expression. Line:", line)
-		os.Exit(3)
-	}
-
-	tokens := []string{}
-	if direction == "right" {
-		for i := index + 1; i < len(expression); i++ {
-			tokens = append(tokens, expression[i])
-		}
-	} else if direction == "left" {
-		for i := 0; i < index; i++ {
-			tokens = append(tokens, expression[i])
+func operatorTypeComparison(node *Node, root *Node) {
+	if node.Left.DType != node.Right.DType {
+		var notes []Diagnostic
+		if declaration := lookupSymbol(node.Left.Value); declaration != nil && node.Left.Type == "IDENTIFIER" {
+			notes = append(notes, noteAt(declaration.Pos, node.Left.Value+" is declared as "+declaration.DType+" here"))
 		}
-	} else {
-		fmt.Println("Did not recognize direction: "+direction+" Line:", line)
-		os.Exit(3)
-	}
-
-	return tokens
-}
 
-func operatorTypeComparison(node *Node) {
-	if node.Left.DType != node.Right.DType {
-		fmt.Println("Type mismatch between " + node.Left.Value + " (" + node.Left.DType + ") " + "and " + node.Right.Value + " (" + node.Right.DType + ") " + " Error: line " + strconv.Itoa(line))
-		os.Exit(3)
+		errorAt(spanOf(node), "Type mismatch between "+node.Left.Value+" ("+node.Left.DType+") "+"and "+node.Right.Value+" ("+node.Right.DType+")", notes...)
 	}
 }
 
-func parseGeneric(tokens []string, lineNumber int, root *Node) *Node {
+func parseGeneric(tokens []Token, root *Node) *Node {
 
 	var newNode Node
 
-	dataType := detectType(strings.Join(tokens, ""))
+	// a lone literal, or a negative number, is used as is
+	dataType := "unknown"
+	if len(tokens) == 1 || (len(tokens) == 2 && tokens[0].Text == "-" && (tokens[1].Kind == "INT" || tokens[1].Kind == "FLOAT")) {
+		dataType = detectType(joinTokens(tokens))
+	}
 
 	if dataType != "unknown" && dataType != "" {
 		switch dataType {
@@ -1070,241 +1638,43 @@ func parseGeneric(tokens []string, lineNumber int, root *Node) *Node {
 			newNode = Node{
 				Type:  dataType,
 				DType: dataType,
-				Value: strings.Join(tokens, ""),
+				Value: joinTokens(tokens),
 			}
 		case "STRING":
 			newNode = Node{
 				Type:  dataType,
 				DType: dataType,
-				Value: strings.Join(tokens, ""),
+				Value: joinTokens(tokens),
 			}
 		case "CHAR":
 			newNode = Node{
 				Type:  dataType,
 				DType: dataType,
-				Value: strings.Join(tokens, ""),
+				Value: joinTokens(tokens),
 			}
 		case "FLOAT":
 			newNode = Node{
 				Type:  dataType,
 				DType: dataType,
-				Value: strings.Join(tokens, ""),
+				Value: joinTokens(tokens),
 			}
 		case "BOOL":
 			newNode = Node{
 				Type:  dataType,
 				DType: dataType,
-				Value: strings.Join(tokens, ""),
+				Value: joinTokens(tokens),
 			}
 		}
 	} else {
-		if slices.Contains(tokens, "=") {
-			newNode = Node{
-				Type:  "ASSIGN",
-				DType: "OP",
-				Value: "=",
-				Left:  parseGeneric(bisect(tokens, "=", "left"), lineNumber, root),
-				Right: parseGeneric(bisect(tokens, "=", "right"), lineNumber, root),
-			}
-
-			if newNode.Right.Value == "{}" {
-				expectedElementType := strings.ToUpper(strings.Split(newNode.Left.DType, "]")[1])
-
-				if newNode.Left.DType != "[]any" {
-					for _, element := range newNode.Right.Body {
-						if element.DType != expectedElementType {
-							fmt.Println("Array element " + element.Value + " does not match array type " + expectedElementType)
-							os.Exit(3)
-						}
-					}
-				}
-			} else if newNode.Right.DType != "OP" {
-				operatorTypeComparison(&newNode)
-			}
-		} else if slices.Contains(tokens, "!=") {
-			newNode = Node{
-				Type:  "NOT_EQUAL",
-				DType: "BOOL",
-				Value: "!=",
-				Left:  parseGeneric(bisect(tokens, "!=", "left"), lineNumber, root),
-				Right: parseGeneric(bisect(tokens, "!=", "right"), lineNumber, root),
-			}
-
-			if newNode.Left.DType != newNode.Right.DType {
-				fmt.Printf("Cannot compare values of different types: %s and %s on line %d\n",
-					newNode.Left.DType, newNode.Right.DType, lineNumber)
-				os.Exit(3)
-			}
-		} else if slices.Contains(tokens, ">=") {
-			newNode = Node{
-				Type:  "GREATER_THAN_OR_EQUAL_TO",
-				DType: "BOOL",
-				Value: ">=",
-				Left:  parseGeneric(bisect(tokens, ">=", "left"), lineNumber, root),
-				Right: parseGeneric(bisect(tokens, ">=", "right"), lineNumber, root),
-			}
-
-			// Check that we're comparing compatible types
-			if newNode.Left.DType != newNode.Right.DType {
-				fmt.Printf("Cannot compare values of different types: %s and %s on line %d\n",
-					newNode.Left.DType, newNode.Right.DType, lineNumber)
-				os.Exit(3)
-			}
-		} else if slices.Contains(tokens, "<=") {
-			newNode = Node{
-				Type:  "LESS_THAN_OR_EQUAL_TO",
-				DType: "BOOL",
-				Value: "<=",
-				Left:  parseGeneric(bisect(tokens, "<=", "left"), lineNumber, root),
-				Right: parseGeneric(bisect(tokens, "<=", "right"), lineNumber, root),
-			}
-
-			// Check that we're comparing compatible types
-			if newNode.Left.DType != newNode.Right.DType {
-				fmt.Printf("Cannot compare values of different types: %s and %s on line %d\n",
-					newNode.Left.DType, newNode.Right.DType, lineNumber)
-				os.Exit(3)
-			}
-		} else if slices.Contains(tokens, ">") {
-			newNode = Node{
-				Type:  "GREATER_THAN",
-				DType: "BOOL",
-				Value: ">",
-				Left:  parseGeneric(bisect(tokens, ">", "left"), lineNumber, root),
-				Right: parseGeneric(bisect(tokens, ">", "right"), lineNumber, root),
-			}
-
-			// Check that we're comparing compatible types
-			if newNode.Left.DType != newNode.Right.DType {
-				fmt.Printf("Cannot compare values of different types: %s and %s on line %d\n",
-					newNode.Left.DType, newNode.Right.DType, lineNumber)
-				os.Exit(3)
-			}
-
-		} else if slices.Contains(tokens, "<") {
-			newNode = Node{
-				Type:  "LESS_THAN",
-				DType: "BOOL",
-				Value: "<",
-				Left:  parseGeneric(bisect(tokens, "<", "left"), lineNumber, root),
-				Right: parseGeneric(bisect(tokens, "<", "right"), lineNumber, root),
-			}
-
-			if newNode.Left.DType != newNode.Right.DType {
-				fmt.Printf("Cannot compare values of different types: %s and %s on line %d\n",
-					newNode.Left.DType, newNode.Right.DType, lineNumber)
-				os.Exit(3)
-			}
-
-		} else if slices.Contains(tokens, "==") {
-			newNode = Node{
-				Type:  "EQUALS",
-				DType: "BOOL",
-				Value: "==",
-				Left:  parseGeneric(bisect(tokens, "==", "left"), lineNumber, root),
-				Right: parseGeneric(bisect(tokens, "==", "right"), lineNumber, root),
-			}
-
-			if newNode.Left.DType != newNode.Right.DType {
-				fmt.Printf("Cannot compare values of different types: %s and %s on line %d\n",
-					newNode.Left.DType, newNode.Right.DType, lineNumber)
-				os.Exit(3)
-			}
-
-		} else if isFunctionCall(tokens) {
-
-			newNode = parseFunctionCall(tokens, line, root)
-
-		} else if slices.Contains(tokens, "%") {
-			newNode = Node{
-				Type:  "MODULO",
-				DType: "OP",
-				Value: "%",
-				Left:  parseGeneric(bisect(tokens, "%", "left"), lineNumber, root),
-				Right: parseGeneric(bisect(tokens, "%", "right"), lineNumber, root),
-			}
-
-			newNode.DType = newNode.Left.DType
-
-		} else if slices.Contains(tokens, "-") {
-			newNode = Node{
-				Type:  "SUB",
-				DType: "OP",
-				Value: "-",
-				Left:  parseGeneric(bisect(tokens, "-", "left"), lineNumber, root),
-				Right: parseGeneric(bisect(tokens, "-", "right"), lineNumber, root),
-			}
-
-			//operatorTypeComparison(&newNode)
-
-			newNode.DType = newNode.Left.DType
-
-		} else if slices.Contains(tokens, "+") {
-			newNode = Node{
-				Type:  "ADD",
-				DType: "OP",
-				Value: "+",
-				Left:  parseGeneric(bisect(tokens, "+", "left"), lineNumber, root),
-				Right: parseGeneric(bisect(tokens, "+", "right"), lineNumber, root),
-			}
-
-			//operatorTypeComparison(&newNode)
-
-			newNode.DType = newNode.Left.DType
-
-		} else if slices.Contains(tokens, "/") {
-			newNode = Node{
-				Type:  "DIV",
-				DType: "OP",
-				Value: "/",
-				Left:  parseGeneric(bisect(tokens, "/", "left"), lineNumber, root),
-				Right: parseGeneric(bisect(tokens, "/", "right"), lineNumber, root),
-			}
-
-			//operatorTypeComparison(&newNode)
-
-			newNode.DType = newNode.Left.DType
-
-		} else if slices.Contains(tokens, "*") {
-			newNode = Node{
-				Type:  "MULT",
-				DType: "OP",
-				Value: "*",
-				Left:  parseGeneric(bisect(tokens, "*", "left"), lineNumber, root),
-				Right: parseGeneric(bisect(tokens, "*", "right"), lineNumber, root),
-			}
-
-			//operatorTypeComparison(&newNode)
-
-			newNode.DType = newNode.Left.DType
-
-		} else if slices.Contains(tokens, "{") {
-			newNode = parseArray(tokens, line, root)
-		} else if slices.Contains(tokens, "[") {
-			newNode = parseArrayIndex(tokens, lineNumber, root)
-		} else if len(tokens) != 0 && isIdentifier(tokens[0]) {
-
-			newNode = Node{
-				Type:  "IDENTIFIER",
-				Value: tokens[0],
-			}
-
-			returnType := returnType(root, &newNode)
-
-			newNode.DType = returnType
-
-			isValid := symbolMan(root, &newNode)
-
-			if !isValid {
-				fmt.Println("Previously undeclared variable assignment: "+tokens[0]+" on line", line)
-				os.Exit(3)
-			}
+		return parseExpression(tokens, root)
+	}
 
-		} else {
-			fmt.Println("Unrecognized character \"" + tokens[0] + "\" on line " + strconv.Itoa(line))
-			os.Exit(3)
+	if newNode.Pos.Line == 0 && len(tokens) > 0 {
+		newNode.Pos = tokens[0].Position
+	}
 
-		}
+	if newNode.Type == "INT" {
+		checkIntRange(&newNode)
 	}
 
 	return &newNode
@@ -1343,10 +1713,6 @@ func detectType(tokens string) string {
 	return types
 }
 
-func isFunctionCall(tokens []string) bool {
-	return len(tokens) > 3 && isIdentifier(tokens[0]) && tokens[1] == "(" && tokens[len(tokens)-1] == ")"
-}
-
 // Helper function to check if token is an integer
 func isInt(token string) bool {
 	_, err := strconv.Atoi(token)
@@ -1378,12 +1744,12 @@ func containsDecimal(token string) bool {
 	}
 	return false
 }
-func findIfBlockEnd(tokens []string) int {
+func findIfBlockEnd(tokens []Token) int {
 	braceCount := 0
 	for i, token := range tokens {
-		if token == "{" {
+		if token.Text == "{" {
 			braceCount++
-		} else if token == "}" {
+		} else if token.Text == "}" {
 			braceCount--
 			if braceCount == 0 {
 				return i + 1 // return the position after the closing brace
@@ -1394,84 +1760,259 @@ func findIfBlockEnd(tokens []string) int {
 }
 
 // Update parseIfStatement to handle the blocks properly
-func parseIfStatement(tokens []string, lineNumber int, root *Node) (Node, int) {
+func parseIfStatement(tokens []Token, root *Node) (Node, int) {
 	newNode := Node{
 		Type:  "IF_STATEMENT",
 		Value: "if",
 		Body:  []*Node{},
+		Pos:   tokens[0].Position,
 	}
 
-	openParenIndex := slices.Index(tokens, "(")
-	closeParenIndex := slices.Index(tokens, ")")
-	if openParenIndex == -1 || closeParenIndex == -1 {
-		fmt.Printf("Missing parentheses in if statement on line %d\n", lineNumber)
-		os.Exit(3)
+	// the condition's "(" comes right after the if, one further on belongs
+	// to something else
+	openParenIndex := 1
+	closeParenIndex := -1
+	if len(tokens) > openParenIndex && tokens[openParenIndex].Text == "(" {
+		closeParenIndex = findMatchingToken(tokens, openParenIndex)
+	}
+	if closeParenIndex == -1 {
+		errorAt(tokens[0].Position, "Missing parentheses in if statement")
 	}
 
 	conditionTokens := tokens[openParenIndex+1 : closeParenIndex]
-	condition := parseGeneric(conditionTokens, lineNumber, root)
+	if len(conditionTokens) == 0 {
+		errorAt(tokens[openParenIndex].Position, "Missing condition in if statement")
+	}
+	condition := parseGeneric(conditionTokens, root)
+	checkCondition(condition, "if")
 	newNode.Left = condition
 
 	// Find '{' that starts the if block
-	ifBlockStart := slices.Index(tokens[closeParenIndex:], "{")
+	ifBlockStart := indexToken(tokens[closeParenIndex:], "{")
 	if ifBlockStart == -1 {
-		fmt.Printf("Missing '{' for if block on line %d\n", lineNumber)
-		os.Exit(3)
+		errorAt(tokens[closeParenIndex].Position, "Missing '{' for if block")
 	}
 	ifBlockStart += closeParenIndex
 
 	// Find matching '}'
 	ifBlockEnd := findMatchingBrace(tokens, ifBlockStart)
 	if ifBlockEnd == -1 {
-		fmt.Println(tokens)
-		fmt.Printf("Missing closing '}' for if block on line %d\n", lineNumber)
-		os.Exit(3)
+		errorAt(tokens[ifBlockStart].Position, "Missing closing '}' for if block")
 	}
 
 	// Parse if block body
 	ifBlockTokens := tokens[ifBlockStart+1 : ifBlockEnd]
-	ifBlockNode := parse(ifBlockTokens, root)
+	ifBlockNode := parseScoped(ifBlockTokens, root, "BLOCK")
 	newNode.Body = ifBlockNode.Body
 
 	tokensConsumed := ifBlockEnd + 1
 
 	// Check for else
-	if tokensConsumed < len(tokens) && tokens[tokensConsumed] == "else" {
+	if tokensConsumed < len(tokens) && tokens[tokensConsumed].Text == "else" {
+		elsePos := tokens[tokensConsumed].Position
 		tokensConsumed++ // skip 'else'
-		if tokensConsumed < len(tokens) && tokens[tokensConsumed] == "{" {
+		if tokensConsumed < len(tokens) && tokens[tokensConsumed].Text == "{" {
 			elseStart := tokensConsumed
 			elseEnd := findMatchingBrace(tokens, elseStart)
 			if elseEnd == -1 {
-				fmt.Printf("Missing closing '}' for else block on line %d\n", lineNumber)
-				os.Exit(3)
+				errorAt(tokens[elseStart].Position, "Missing closing '}' for else block")
 			}
 
 			elseTokens := tokens[elseStart+1 : elseEnd]
-			elseBlockNode := parse(elseTokens, root)
+			elseBlockNode := parseScoped(elseTokens, root, "BLOCK")
 			elseNode := Node{
 				Type:  "ELSE_STATEMENT",
 				Value: "else",
 				Body:  elseBlockNode.Body,
+				Pos:   elsePos,
 			}
 			newNode.Right = &elseNode
 
 			tokensConsumed = elseEnd + 1
+		} else if tokensConsumed < len(tokens) && tokens[tokensConsumed].Text == "if" {
+			// "else if" is an else block holding just the next if, so a
+			// chain of any length nests down the Right of each if
+			elseIfNode, elseIfConsumed := parseIfStatement(tokens[tokensConsumed:], root)
+			elseNode := Node{
+				Type:  "ELSE_STATEMENT",
+				Value: "else",
+				Body:  []*Node{&elseIfNode},
+				Pos:   elsePos,
+			}
+			newNode.Right = &elseNode
+
+			tokensConsumed += elseIfConsumed
 		} else {
-			fmt.Printf("Missing '{' after else on line %d\n", lineNumber)
-			os.Exit(3)
+			errorAt(elsePos, "Missing '{' or 'if' after else")
 		}
 	}
 
 	return newNode, tokensConsumed
 }
 
+// skipStatement returns the index just past the statement starting at start,
+// including any else blocks of an if
+func skipStatement(tokens []Token, start int) int {
+	end := skipLine(tokens, start)
+	for end < len(tokens) && tokens[end].Text == "else" {
+		end = skipLine(tokens, end)
+	}
+	if tokens[start].Text == "do" && end < len(tokens) && tokens[end].Text == "while" {
+		end = skipLine(tokens, end)
+	}
+	return max(end, start+1)
+}
+
+// skipLine returns the index just past the line starting at start. An if,
+// else, loop or switch goes on to the "}" that closes its block, wherever
+// the "{" that opens it is
+func skipLine(tokens []Token, start int) int {
+	switch tokens[start].Text {
+	case "if", "else", "for", "while", "do", "switch":
+		open := indexToken(tokens[start:], "{")
+		if open == -1 {
+			break
+		}
+		open += start
+		if closing := findMatchingBrace(tokens[open:], 0); closing != -1 {
+			// the rest of the line after the "}", like "} else {...}"
+			closing += open
+			return findEndLine(tokens[closing+1:]) + closing + 2
+		}
+	}
+	return findEndLine(tokens[start:]) + start + 1
+}
+
+// parseSwitch parses "switch (value) { case 1, 2: ... default: ... }" into a
+// SWITCH_STATEMENT whose Body holds a CASE (values in Params) or DEFAULT per
+// clause. Cases don't fall through
+func parseSwitch(tokens []Token, root *Node) (Node, int) {
+	newNode := Node{
+		Type:  "SWITCH_STATEMENT",
+		Value: "switch",
+		Pos:   tokens[0].Position,
+	}
+
+	if len(tokens) < 2 || tokens[1].Text != "(" {
+		errorAt(tokens[0].Position, "Expected \"(\" after switch")
+	}
+	closeParenIndex := findMatchingToken(tokens, 1)
+	if closeParenIndex == -1 {
+		errorAt(tokens[1].Position, "Missing closing \")\" in switch")
+	}
+
+	newNode.Left = parseGeneric(tokens[2:closeParenIndex], root)
+	if newNode.Left.DType != "INT" && newNode.Left.DType != "CHAR" && !isEnumType(newNode.Left.DType) {
+		errorAt(spanOf(newNode.Left), "Can only switch on int, char or an enum, got "+newNode.Left.DType)
+	}
+
+	blockStart := closeParenIndex + 1
+	if blockStart >= len(tokens) || tokens[blockStart].Text != "{" {
+		errorAt(tokens[closeParenIndex].Position, "Missing '{' for switch block")
+	}
+	blockEnd := findMatchingBrace(tokens, blockStart)
+	if blockEnd == -1 {
+		errorAt(tokens[blockStart].Position, "Missing closing '}' for switch block")
+	}
+
+	// Each clause runs from its case or default to the next one at the same depth
+	var clauseStarts []int
+	depth := 0
+	for i := blockStart + 1; i < blockEnd; i++ {
+		switch tokens[i].Text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		case "case", "default":
+			if depth == 0 {
+				clauseStarts = append(clauseStarts, i)
+			}
+		default:
+			if depth == 0 && len(clauseStarts) == 0 && tokens[i].Text != "\n" {
+				errorAt(tokens[i].Position, "Expected case or default in switch, got "+tokens[i].Text)
+			}
+		}
+	}
+	clauseStarts = append(clauseStarts, blockEnd)
+
+	seenValues := make(map[int]Position)
+	var defaultPos *Position
+
+	for c := 0; c < len(clauseStarts)-1; c++ {
+		clauseTokens := tokens[clauseStarts[c]:clauseStarts[c+1]]
+		keyword := clauseTokens[0]
+
+		colonIndex := indexToken(clauseTokens, ":")
+		if colonIndex == -1 {
+			errorAt(keyword.Position, "Missing ':' after "+keyword.Text)
+		}
+
+		clause := Node{
+			Type:  strings.ToUpper(keyword.Text),
+			Value: keyword.Text,
+			Pos:   keyword.Position,
+		}
+
+		if keyword.Text == "default" {
+			if colonIndex != 1 {
+				errorAt(clauseTokens[1].Position, "Expected ':' after default")
+			}
+			if defaultPos != nil {
+				errorAt(keyword.Position, "Switch already has a default", noteAt(*defaultPos, "first default is here"))
+			}
+			defaultPos = &keyword.Position
+		} else {
+			if colonIndex == 1 {
+				errorAt(keyword.Position, "Expected a value after case")
+			}
+
+			for _, valueTokens := range splitArguments(clauseTokens[1:colonIndex]) {
+				if len(valueTokens) == 0 {
+					errorAt(keyword.Position, "Empty case value")
+				}
+				value := parseGeneric(valueTokens, root)
+
+				if value.Type != "INT" && value.Type != "CHAR" {
+					errorAt(spanOf(value), "Case value must be an int, char or enum constant")
+				}
+				if value.DType != newNode.Left.DType {
+					errorAt(spanOf(value), "Case value "+value.Value+" ("+value.DType+") does not match switch value ("+newNode.Left.DType+")")
+				}
+
+				key := caseKey(value)
+				if firstPos, seen := seenValues[key]; seen {
+					reportAt(SeverityError, spanOf(value), "Duplicate case value "+value.Value, noteAt(firstPos, "first used here"))
+				} else {
+					seenValues[key] = spanOf(value)
+				}
+
+				clause.Params = append(clause.Params, value)
+			}
+		}
+
+		clause.Body = parseScoped(clauseTokens[colonIndex+1:], root, "BLOCK").Body
+		newNode.Body = append(newNode.Body, &clause)
+	}
+
+	return newNode, blockEnd + 1
+}
+
+// caseKey is the number a switch compares an int or char case value as
+func caseKey(value *Node) int {
+	if value.Type == "CHAR" {
+		return int(unquoteLiteral(value.Value)[0])
+	}
+	return atoi(value.Value)
+}
+
 // Helper function to find matching closing brace
-func findMatchingBrace(tokens []string, openIndex int) int {
+func findMatchingBrace(tokens []Token, openIndex int) int {
 	count := 1
 	for i := openIndex + 1; i < len(tokens); i++ {
-		if tokens[i] == "{" {
+		if tokens[i].Text == "{" {
 			count++
-		} else if tokens[i] == "}" {
+		} else if tokens[i].Text == "}" {
 			count--
 			if count == 0 {
 				return i
@@ -1480,16 +2021,3 @@ func findMatchingBrace(tokens []string, openIndex int) int {
 	}
 	return -1
 }
-
-func passGlobals(root *Node) []*Node {
-	var globals []*Node
-	for _, node := range root.Declared {
-		if node.Scope == "GLOBAL" {
-			globals = append(globals, node)
-		}
-		if node.Type == "FUNCTION_DECL" {
-			globals = append(globals, node)
-		}
-	}
-	return globals
-}
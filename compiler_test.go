@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// compiled is what compiling a snippet gives: the diagnostics reported, and
+// the TAC and MIPS when there were no errors
+type compiled struct {
+	diagnostics string
+	tac         string
+	mips        string
+}
+
+// resetCompiler clears everything a previous compile left behind
+func resetCompiler() {
+	Diagnostics = nil
+	sourceLines = make(map[string][]string)
+
+	DeclaredFunctions = ValueTable{}
+	DeclaredStructs = ValueTable{}
+	DeclaredEnums = ValueTable{}
+	currentFunction = nil
+	currentScope = &Scope{Kind: "GLOBAL", Symbols: make(map[string]*Node)}
+	WarnShadow = true
+	shadowCount = 0
+	functionLocals = make(map[string][]string)
+
+	Values = ValueTable{}
+	Functions = ValueTable{}
+	inlinedStatements = nil
+	inlineDepth = 0
+	cappedLoops = make(map[Position]bool)
+
+	symbolTable = make(map[string]string)
+	loopLabels = nil
+	labelCounter = 0
+	optimizedTempVarCounter = 0
+
+	intConstants = make(map[string]int)
+	stringConstants = make(map[string]bool)
+}
+
+// compile runs a snippet through every stage main does, stopping at the
+// first one that reports an error
+func compile(t *testing.T, source string) compiled {
+	t.Helper()
+	resetCompiler()
+
+	var result compiled
+	diagnostics := func() string {
+		var text strings.Builder
+		for _, diagnostic := range Diagnostics {
+			text.WriteString(diagnostic.String())
+		}
+		return text.String()
+	}
+
+	root := Node{}
+	parse(lex("test.josh", source), &root)
+	if hasErrors() {
+		result.diagnostics = diagnostics()
+		return result
+	}
+
+	optimizedAST, ok := optimize(&root)
+	if !ok || hasErrors() {
+		result.diagnostics = diagnostics()
+		return result
+	}
+
+	var tac strings.Builder
+	writer := bufio.NewWriter(&tac)
+	generateOptimizedTAC(&optimizedAST, writer)
+	writer.Flush()
+
+	result.diagnostics = diagnostics()
+	result.tac = tac.String()
+	result.mips = generateMIPS(parseTAC(strings.Split(result.tac, "\n")))
+	return result
+}
+
+// optimize folds the parsed program like main, with the errors that stop
+// the optimizer recovered
+func optimize(root *Node) (optimizedAST Node, ok bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			recoverStatement(recovered)
+			ok = false
+		}
+	}()
+
+	optimizedAST = optimizer(root)
+	finalRound(&optimizedAST)
+	finalRound(&optimizedAST)
+	return optimizedAST, true
+}
+
+// run compiles a snippet that has to compile without errors, and returns
+// what the MIPS it compiles to writes
+func run(t *testing.T, source string) string {
+	t.Helper()
+
+	result := compile(t, source)
+	if result.mips == "" {
+		t.Fatalf("compile failed:\n%s", result.diagnostics)
+	}
+	return simulate(t, result.mips)
+}
+
+// diagnosticCase is a snippet and a message its diagnostics must hold
+type diagnosticCase struct {
+	name    string
+	source  string
+	message string
+}
+
+// checkDiagnostics compiles each case and looks for its message
+func checkDiagnostics(t *testing.T, cases []diagnosticCase) {
+	t.Helper()
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			result := compile(t, test.source)
+			if !strings.Contains(result.diagnostics, test.message) {
+				t.Errorf("diagnostics don't mention %q:\n%s", test.message, result.diagnostics)
+			}
+		})
+	}
+}
+
+// outputCase is a snippet and what it writes when run
+type outputCase struct {
+	name   string
+	source string
+	output string
+}
+
+// checkOutput runs each case and compares what it writes
+func checkOutput(t *testing.T, cases []outputCase) {
+	t.Helper()
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if output := run(t, test.source); output != test.output {
+				t.Errorf("wrote %q, want %q", output, test.output)
+			}
+		})
+	}
+}
+
+// runtimeValue makes n a value only known at runtime: the loop runs past
+// what is unrolled at compile time, and leaves n at 2000
+const runtimeValue = `
+int n = 0
+while (n < 2000) {
+    n++
+}
+`
+
+func TestAssignmentIsNotAValue(t *testing.T) {
+	checkDiagnostics(t, []diagnosticCase{
+		{"chained", "int a\nint b\na = b = 5\nwrite(a)\n", "An assignment has no value, assign b in a statement of its own"},
+		{"chained mismatch", "int a\nstring b\na = b = \"x\"\n", "An assignment has no value, assign b in a statement of its own"},
+		{"operand", "int a\nint k\nk = (a = 3) + 1\n", "An assignment has no value, assign a in a statement of its own"},
+		{"initializer", "int a\nint c = a = 2\n", "An assignment has no value, assign a in a statement of its own"},
+		{"argument", "int a\nwrite(a = 2)\n", "An assignment has no value, assign a in a statement of its own"},
+	})
+
+	checkOutput(t, []outputCase{
+		{"separate statements", "int a\nint b\nb = 5\na = b\nwrite(a)\n", "5"},
+	})
+}
+
+func TestDocCommentsReachTheTree(t *testing.T) {
+	resetCompiler()
+	root := Node{}
+	parse(lex("test.josh", "/// doubles\nfunc f(int a) int {\n    return a * 2\n}\n/// the count\nglobal int count = 1\n/// never set\nglobal bool done\n/// the slots\n/// all three\nglobal [3]int slots\nint plain = 2\n"), &root)
+	if hasErrors() {
+		t.Fatalf("parse failed: %v", Diagnostics)
+	}
+
+	docs := map[string]string{}
+	for _, statement := range root.Body {
+		if statement.Doc != "" {
+			docs[statement.Value] = statement.Doc
+		}
+	}
+	want := map[string]string{"f": "doubles", "count": "the count", "done": "never set", "slots": "the slots\nall three"}
+	for name, doc := range want {
+		if docs[name] != doc {
+			t.Errorf("doc of %s is %q, want %q", name, docs[name], doc)
+		}
+	}
+	if len(docs) != len(want) {
+		t.Errorf("docs %v, want %v", docs, want)
+	}
+}
+
+func TestBrokenReturnStillReturns(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		message string
+		missing bool
+	}{
+		{"bad value", "func f(int a) int {\n    return a +\n}\nwrite(f(1))\n", "Expected a value after \"+\"", false},
+		{"bad value in a branch", "func f(int a) int {\n    if (a > 0) {\n        return a *\n    } else {\n        return 1\n    }\n}\nwrite(f(1))\n", "Expected a value after \"*\"", false},
+		{"wrong type", "func f(int a) int {\n    return \"a\"\n}\nwrite(f(1))\n", "error", false},
+		{"no return", "func f(int a) int {\n    a = a + 1\n}\nwrite(f(1))\n", "Missing return at the end of f, which returns INT", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := compile(t, test.source)
+			if !strings.Contains(result.diagnostics, test.message) {
+				t.Errorf("diagnostics don't mention %q:\n%s", test.message, result.diagnostics)
+			}
+			if missing := strings.Contains(result.diagnostics, "Missing return"); missing != test.missing {
+				t.Errorf("missing return reported: %v, want %v:\n%s", missing, test.missing, result.diagnostics)
+			}
+		})
+	}
+}
+
+func TestElseIfChains(t *testing.T) {
+	const sizes = "if (n < 10) {\n    write(\"small\")\n} else if (n < 1000) {\n    write(\"medium\")\n} else if (n < LIMIT) {\n    write(\"large\")\n} else {\n    write(\"huge\")\n}\n"
+	chain := func(n string, limit string) string {
+		return strings.ReplaceAll(strings.ReplaceAll(sizes, "LIMIT", limit), "(n", "("+n)
+	}
+	checkOutput(t, []outputCase{
+		{"first", chain("5", "3000"), "small"},
+		{"middle", chain("500", "3000"), "medium"},
+		{"last", chain("2000", "3000"), "large"},
+		{"else", chain("2000", "1500"), "huge"},
+		{"literal condition", "if (True) {\n    write(1)\n}\n", "1"},
+		{"bool variable condition", "bool b = True\nif (b) {\n    write(1)\n} else {\n    write(2)\n}\n", "1"},
+		{"first true wins", "if (True) {\n    write(1)\n} else if (True) {\n    write(2)\n}\n", "1"},
+		{"none without else", "if (False) {\n    write(1)\n} else if (False) {\n    write(2)\n}\nwrite(3)\n", "3"},
+		{"runtime last", runtimeValue + chain("n", "3000"), "large"},
+		{"runtime else", runtimeValue + chain("n", "1500"), "huge"},
+		{"runtime nested", runtimeValue + "if (n < 10) {\n    write(1)\n} else if (n > 10) {\n    if (n == 2000) {\n        write(2)\n    } else {\n        write(3)\n    }\n}\n", "2"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"else alone", "else {\n    write(1)\n}\n", "else without an if before it"},
+		{"else on the next line", "if (True) {\n    write(1)\n}\nelse {\n    write(2)\n}\n", "else without an if before it"},
+		{"else if without condition", "if (True) {\n    write(1)\n} else if {\n    write(2)\n}\nif (True) {\n    write(3)\n}\n", "Missing parentheses in if statement"},
+		{"empty condition", "if () {\n    write(1)\n}\n", "Missing condition in if statement"},
+		{"int condition", "if (True) {\n    write(1)\n} else if (1) {\n    write(2)\n}\n", "Condition of if must be BOOL, got INT"},
+		{"else without block", "if (True) {\n    write(1)\n} else write(2)\n", "Missing '{' or 'if' after else"},
+	})
+}
+
+func TestBreakAndContinue(t *testing.T) {
+	const skipAndStop = "int s = 0\nfor (int i = 0; i < LIMIT; i++) {\n    if (i == 3) {\n        continue\n    }\n    if (i == 6) {\n        break\n    }\n    s = s + i\n}\nwrite(s)\n"
+	checkOutput(t, []outputCase{
+		{"for", strings.ReplaceAll(skipAndStop, "LIMIT", "10"), "12"},
+		{"runtime for", runtimeValue + strings.ReplaceAll(skipAndStop, "LIMIT", "n"), "12"},
+		{"runtime while", runtimeValue + "int k = 0\nint t = 0\nwhile (k < n) {\n    k++\n    if (k % 2 == 0) {\n        continue\n    }\n    if (k > 9) {\n        break\n    }\n    t = t + k\n}\nwrite(t)\n", "25"},
+		{"inner loop only", runtimeValue + "int r = 0\nfor (int i = 0; i < n; i++) {\n    for (int j = 0; j < 5; j++) {\n        if (j == 2) {\n            break\n        }\n        r++\n    }\n    if (i == 3) {\n        break\n    }\n}\nwrite(r)\n", "8"},
+		{"do while", runtimeValue + "int d = 0\ndo {\n    d++\n    if (d < n) {\n        continue\n    }\n    break\n} while (True)\nwrite(d)\n", "2000"},
+		{"in a switch", "int i = 0\nwhile (i < 10) {\n    i++\n    switch (i) {\n    case 4:\n        break\n    }\n}\nwrite(i)\n", "4"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"outside a loop", "break\n", "\"break\" is only allowed inside a loop"},
+		{"in a function", "func f() {\n    continue\n}\n", "\"continue\" is only allowed inside a loop"},
+		{"in an if", "if (True) {\n    break\n}\n", "\"break\" is only allowed inside a loop"},
+		{"with a value", "while (True) {\n    break 2\n}\n", "Unexpected \"2\" after break"},
+	})
+}
+
+func TestStructs(t *testing.T) {
+	const point = "struct Point {\n    int x\n    int y\n}\n"
+	const line = point + "struct Line { Point from; Point to; char tag }\n"
+	const shifted = "func shifted(Point p, int by) Point {\n    Point moved = p\n    moved.x += by\n    moved.y = moved.y + by\n    return moved\n}\n"
+	checkOutput(t, []outputCase{
+		{"positional literal", point + "Point a = Point{1, 2}\nwrite(a.x + a.y * 10)\n", "21"},
+		{"named literal", point + "Point a = Point{y: 5}\nwrite(a.x)\nwrite(a.y)\n", "05"},
+		{"zeroed", point + "Point a\nwrite(a.x)\nwrite(a.y)\n", "00"},
+		{"nested", line + "Line l = Line{from: Point{1, 2}, to: Point{4, 6}, tag: 'L'}\nwrite(l.to.x - l.from.x)\nwrite(l.tag)\n", "3L"},
+		{"nested field assignment", line + "Line l\nl.to.y = 7\nl.from = Point{1, 1}\nwrite(l.to.y + l.from.x)\n", "8"},
+		{"copy", point + "Point a = Point{1, 2}\nPoint b = a\nb.x = 9\nwrite(a.x)\nwrite(b.x)\n", "19"},
+		{"param and return", point + shifted + "write(shifted(Point{1, 2}, 10).y)\n", "12"},
+		{"runtime fields", runtimeValue + point + shifted + "Point r = Point{y: 5}\nr.x = n\nPoint s = shifted(r, 1)\nwrite(s.x)\nwrite(s.y)\n", "20016"},
+		{"runtime loop", point + "Point r\nfor (int i = 0; i < 2000; i++) {\n    r.x = r.x + 1\n}\nwrite(r.x)\n", "2000"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"duplicate field", "struct P {\n    int x\n    int x\n}\n", "Duplicate field x in struct P"},
+		{"unknown field type", "struct P {\n    widget w\n}\n", "Unknown type widget for field w"},
+		{"redeclared", point + "struct Point { int z }\n", "Struct Point has already been declared!"},
+		{"empty", "struct Empty { }\n", "Struct Empty has no fields"},
+		{"contains itself", "struct Self { Self s }\n", "Struct Self cannot contain itself"},
+		{"too many values", point + "Point a = Point{1, 2, 3}\n", "Too many values for struct Point, it has 2 fields"},
+		{"mixed literal", point + "Point a = Point{x: 1, 2}\n", "Struct literal mixes named and positional fields"},
+		{"unknown field", point + "Point a = Point{z: 1}\n", "Struct Point has no field z"},
+		{"field type", point + "Point a = Point{\"one\"}\n", "Field x of Point is INT, got \"one\" (STRING)"},
+		{"arithmetic", point + "Point a\nPoint b\nPoint c = a + b\n", "Cannot apply \"+\" to a struct, only to its fields"},
+		{"comparison", point + "Point a\nPoint b\nbool same = a == b\n", "Cannot apply \"==\" to a struct, only to its fields"},
+		{"write", point + "Point a\nwrite(a)\n", "Cannot write a (Point), write its fields instead"},
+		{"not a struct", "int n = 1\nint m = n.x\n", "n (INT) is not a struct, it has no field x"},
+		{"assigned to an int", point + "Point a\nint k = a\n", "Type mismatch between k (INT) and a (Point)"},
+		{"ternary", point + "Point a\nPoint b\nPoint t = True ? a : b\n", "The arms of \"?:\" cannot be structs, pick between their fields instead"},
+		{"in a function", "func inner() {\n    struct Local { int q }\n}\n", "Structs can only be declared at the top level"},
+	})
+}
+
+func TestEnums(t *testing.T) {
+	const color = "enum Color { Red, Green, Blue }\n"
+	const level = "enum Level {\n    Low = -1,\n    Mid,\n    High = 10,\n}\n"
+	checkOutput(t, []outputCase{
+		{"writes the name", color + "Color c = Green\nwrite(c)\n", "Green"},
+		{"qualified", color + "write(Color.Blue)\n", "Blue"},
+		{"explicit values", level + "write(Mid)\nLevel l = High\nif (l == Level.High) {\n    write(\"high\")\n}\n", "Midhigh"},
+		{"ordered", color + level + "write(Red < Blue)\nwrite(High > Low)\n", "11"},
+		{"param and return", color + "func warmer(Color c) Color {\n    if (c == Blue) {\n        return Green\n    }\n    return Red\n}\nwrite(warmer(Blue))\nwrite(warmer(Red))\n", "GreenRed"},
+		{"struct field", color + "struct Pixel { Color color; int x }\nPixel p\nwrite(p.color)\n", "Red"},
+		{"switch", color + "Color c = Blue\nswitch (c) {\ncase Red:\n    write(\"r\")\ncase Green, Blue:\n    write(\"gb\")\n}\n", "gb"},
+		{"runtime", color + "Color spin = Red\nfor (int i = 0; i < 3001; i++) {\n    spin = spin == Red ? Green : Red\n}\nwrite(spin)\nwrite(spin < Blue)\nswitch (spin) {\ncase Red:\n    write(\"red\")\ndefault:\n    write(\"other\")\n}\n", "Green1other"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"duplicate value", "enum Dup { A = 1, B = 1 }\n", "Enum value 1 of B is already used by A"},
+		{"member redeclared", color + "enum Other { Red }\n", "Red has already been declared!"},
+		{"redeclared", color + "enum Color { X }\n", "Color has already been declared!"},
+		{"no members", "enum Empty { }\n", "Enum Empty has no members"},
+		{"float value", "enum Bad { Q = 1.5 }\n", "Value of enum member Q must be an int literal"},
+		{"missing value", "enum Bad { Q = }\n", "Expected \"= value\" after enum member Q"},
+		{"assigned to an int", color + "int n = Red\n", "Type mismatch between n (INT) and 0 (Color)"},
+		{"assigned an int", color + "Color c = 1\n", "Type mismatch between c (Color) and 1 (INT)"},
+		{"compared to an int", color + "Color c = Red\nbool b = c == 1\n", "Cannot compare values of different types: Color and INT"},
+		{"arithmetic", color + "Color d = Red + 1\n", "Cannot apply \"+\" to an enum, only compare it"},
+		{"increment", color + "Color c = Red\nc++\n", "Cannot apply \"++\" to c (Color)"},
+		{"member shadowed", color + "int Green = 4\n", "Green has already been declared in this scope"},
+	})
+}
+
+func TestConsts(t *testing.T) {
+	const limit = "const int LIMIT = 10\n"
+	checkOutput(t, []outputCase{
+		{"folded initialiser", limit + "const int DOUBLE = LIMIT * 2\nwrite(DOUBLE)\n", "20"},
+		{"every type", "enum Mode { Off, On }\nconst float RATE = 1.5\nconst string NAME = \"limit\"\nconst Mode START = On\nconst char TAG = 'c'\nwrite(RATE)\nwrite(NAME)\nwrite(START)\nwrite(TAG)\n", "1.5limitOnc"},
+		{"in a function", limit + "func scaled(int x) int {\n    const int FACTOR = 3\n    return x * FACTOR + LIMIT\n}\nwrite(scaled(2))\n", "16"},
+		{"runtime loop", limit + "int total = 0\nfor (int i = 0; i < 2000; i++) {\n    total = total + LIMIT\n}\nwrite(total)\n", "20000"},
+	})
+
+	t.Run("no storage", func(t *testing.T) {
+		result := compile(t, limit+runtimeValue+"write(n + LIMIT)\n")
+		if result.mips == "" {
+			t.Fatalf("compile failed:\n%s", result.diagnostics)
+		}
+		if strings.Contains(result.tac, "LIMIT") {
+			t.Errorf("LIMIT was not inlined:\n%s", result.tac)
+		}
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"no value", "const int NOVALUE\n", "Const NOVALUE needs a value"},
+		{"wrong type", "const int WRONG = \"x\"\n", "Type mismatch between WRONG (INT) and \"x\" (STRING)"},
+		{"in a function", limit + "func change() {\n    LIMIT = 5\n}\n", "Cannot assign to const LIMIT"},
+		{"compound", limit + "LIMIT += 1\n", "Cannot assign to const LIMIT"},
+		{"increment", limit + "LIMIT++\n", "Cannot assign to const LIMIT"},
+		{"for step", limit + "for (int i = 0; i < 3; LIMIT = LIMIT + 1) {\n    write(i)\n}\n", "Cannot assign to const LIMIT"},
+		{"for init", limit + "for (LIMIT = 0; LIMIT < 3; LIMIT++) {\n    write(1)\n}\n", "Cannot assign to const LIMIT"},
+		{"runtime value", runtimeValue + "const int LATER = n + 1\nwrite(LATER)\n", "The value of const LATER must be known at compile time"},
+	})
+}
+
+func TestReturnChecking(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"widened", "func half(int n) float {\n    return n / 2\n}\nwrite(half(7))\n", "3.0"},
+		{"every if arm", "func sign(int n) int {\n    if (n > 0) {\n        return 1\n    } else if (n < 0) {\n        return -1\n    } else {\n        return 0\n    }\n}\nwrite(sign(-4))\nwrite(sign(0))\n", "-10"},
+		{"every switch case", "func pick(int n) char {\n    switch (n) {\n    case 1:\n        return 'a'\n    default:\n        return 'b'\n    }\n}\nwrite(pick(1))\nwrite(pick(2))\n", "ab"},
+		{"after an if", "func pick(int n) int {\n    if (n > 5) {\n        return 1\n    }\n    return 2\n}\nwrite(pick(7))\nwrite(pick(1))\n", "12"},
+		{"bare", "func greet(int times) {\n    if (times == 0) {\n        return\n    }\n    write(\"hi\")\n    return\n}\ngreet(0)\ngreet(2)\n", "hi"},
+		{"void", "func nothing(int n) {\n    write(n)\n}\nnothing(3)\n", "3"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"narrowed", "func a(int n) int {\n    return 2.5\n}\n", "Cannot implicitly narrow 2.5 (FLOAT) to INT, convert it with int()"},
+		{"wrong type", "func e(int n) string {\n    return n\n}\n", "Returned value n (INT) does not match the return type of e (STRING)"},
+		{"value from void", "func d(int n) {\n    return n\n}\n", "Unexpected return in function d which is void of returns!"},
+		{"missing after if", "func b(int n) int {\n    if (n > 0) {\n        return 1\n    }\n}\n", "Missing return at the end of b, which returns INT"},
+		{"missing after loop", "func f(int n) int {\n    for (int i = 0; i < n; i++) {\n        return i\n    }\n}\n", "Missing return at the end of f, which returns INT"},
+		{"switch without default", "func g(int n) int {\n    switch (n) {\n    case 1:\n        return 1\n    }\n}\n", "Missing return at the end of g, which returns INT"},
+		{"unreachable", "func c(int n) int {\n    return 1\n    write(n)\n}\n", "3:5: warning: Unreachable code after return"},
+		{"unreachable in a loop", "func f(int n) int {\n    for (int i = 0; i < n; i++) {\n        return i\n        write(i)\n    }\n    return 0\n}\n", "4:9: warning: Unreachable code after return"},
+		{"top level", "return 5\n", "return is only allowed inside a function"},
+		{"decided at runtime", runtimeValue + "func pick(int k) int {\n    if (k > 5) {\n        return 1\n    }\n    return 2\n}\nwrite(pick(n))\n", "A return inside an if, switch or loop decided at runtime is not supported"},
+	})
+}
+
+func TestCallArguments(t *testing.T) {
+	const scale = "func scale(float x, int n) float {\n    return x * n\n}\n"
+	const getA = "struct P {\n    int a\n}\nfunc getA(P p) int {\n    return p.a\n}\n"
+	checkOutput(t, []outputCase{
+		{"int widened to float", scale + "write(scale(3, 2))\n", "6.0"},
+		{"char widened to int", scale + "char c = 'b'\nwrite(scale(1.5, c))\n", "147.0"},
+		{"struct", getA + "write(getA(P{4}))\n", "4"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"too few", scale + "write(scale(3))\n", "Too few arguments to scale: it takes 2, got 1, missing n (INT)"},
+		{"none", scale + "write(scale())\n", "Too few arguments to scale: it takes 2, got 0, missing x (FLOAT), n (INT)"},
+		{"too many", scale + "write(scale(3, 2, 1))\n", "Too many arguments to scale: it takes 2, got 3"},
+		{"narrowed", scale + "write(scale(3, 2.5))\n", "Parameter n of scale is INT, got 2.5 (FLOAT), convert it with int()"},
+		{"wrong type", scale + "write(scale(\"a\", 2))\n", "Parameter x of scale is FLOAT, got \"a\" (STRING)"},
+		{"not a struct", getA + "write(getA(5))\n", "Parameter p of getA is P, got 5 (INT)"},
+		{"shadowing param", "global int g = 1\nfunc useG(int g) int {\n    return g\n}\nwrite(useG(1.5))\n", "Parameter g of useG is INT, got 1.5 (FLOAT), convert it with int()"},
+		{"expression", scale + "write(scale(1.5, 2 == 2))\n", "Parameter n of scale is INT, got a BOOL value"},
+		{"narrowed expression", scale + "write(scale(1.5, 2.5 * 2))\n", "Parameter n of scale is INT, got a FLOAT value, convert it with int()"},
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Severities of a Diagnostic
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityNote    = "note"
+)
+
+// Diagnostic is a single problem found in the source, with any notes that
+// point at related places such as an earlier declaration
+type Diagnostic struct {
+	Severity string
+	Pos      Position
+	Message  string
+	Notes    []Diagnostic
+}
+
+// Diagnostics collects everything reported while compiling
+var Diagnostics []Diagnostic
+
+// sourceLines keeps every lexed file split into lines, for printing snippets
+var sourceLines = make(map[string][]string)
+
+// abortStatement is what errorAt panics with. The parser recovers from it at
+// the next statement boundary, so one run reports every broken statement
+type abortStatement struct{}
+
+func (diagnostic Diagnostic) String() string {
+	var text strings.Builder
+
+	if diagnostic.Pos.Line == 0 {
+		text.WriteString(diagnostic.Severity + ": " + diagnostic.Message + "\n")
+	} else {
+		text.WriteString(diagnostic.Pos.String() + ": " + diagnostic.Severity + ": " + diagnostic.Message + "\n")
+		text.WriteString(snippet(diagnostic.Pos))
+	}
+
+	for _, note := range diagnostic.Notes {
+		text.WriteString(note.String())
+	}
+
+	return text.String()
+}
+
+// snippet renders the source line at pos with the span underlined:
+//
+//	3 | int c = a + b
+//	  |         ^~~~~
+func snippet(pos Position) string {
+	lines := sourceLines[pos.File]
+	if pos.Line > len(lines) {
+		return ""
+	}
+	line := []rune(strings.TrimRight(lines[pos.Line-1], "\r"))
+
+	// keep tabs in the padding so the caret lines up with the source
+	var padding strings.Builder
+	for i := 0; i < pos.Col-1 && i < len(line); i++ {
+		if line[i] == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+
+	width := max(1, min(pos.Len, len(line)-(pos.Col-1)))
+	gutter := fmt.Sprintf("%5d", pos.Line)
+
+	return fmt.Sprintf("%s | %s\n%s | %s^%s\n",
+		gutter, string(line),
+		strings.Repeat(" ", len(gutter)), padding.String(), strings.Repeat("~", width-1))
+}
+
+// reportAt records a diagnostic and carries on
+func reportAt(severity string, pos Position, message string, notes ...Diagnostic) {
+	Diagnostics = append(Diagnostics, Diagnostic{Severity: severity, Pos: pos, Message: message, Notes: notes})
+}
+
+// errorAt records a compile error and abandons the statement being compiled
+func errorAt(pos Position, message string, notes ...Diagnostic) {
+	reportAt(SeverityError, pos, message, notes...)
+	panic(abortStatement{})
+}
+
+func warningAt(pos Position, message string, notes ...Diagnostic) {
+	reportAt(SeverityWarning, pos, message, notes...)
+}
+
+// noteAt builds a note to attach to an error or warning
+func noteAt(pos Position, message string) Diagnostic {
+	return Diagnostic{Severity: SeverityNote, Pos: pos, Message: message}
+}
+
+// spanOf widens a node's position to also cover its children on the same
+// line, so a whole expression gets underlined instead of just its operator
+func spanOf(node *Node) Position {
+	span := node.Pos
+	end := span.Col + span.Len
+
+	var widen func(child *Node)
+	widen = func(child *Node) {
+		if child == nil {
+			return
+		}
+		if child.Pos.File == span.File && child.Pos.Line == span.Line {
+			span.Col = min(span.Col, child.Pos.Col)
+			end = max(end, child.Pos.Col+child.Pos.Len)
+		}
+
+		widen(child.Left)
+		widen(child.Right)
+		for _, param := range child.Params {
+			widen(param)
+		}
+		for _, bodyNode := range child.Body {
+			widen(bodyNode)
+		}
+	}
+	widen(node)
+
+	span.Len = end - span.Col
+	return span
+}
+
+func hasErrors() bool {
+	for _, diagnostic := range Diagnostics {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// printDiagnostics prints everything reported so far in source order, and
+// clears it. Diagnostics at the same place keep the order they were reported in
+func printDiagnostics() {
+	slices.SortStableFunc(Diagnostics, func(a, b Diagnostic) int {
+		return cmp.Or(
+			cmp.Compare(a.Pos.File, b.Pos.File),
+			cmp.Compare(a.Pos.Line, b.Pos.Line),
+			cmp.Compare(a.Pos.Col, b.Pos.Col),
+		)
+	})
+
+	errors, warnings := 0, 0
+	for _, diagnostic := range Diagnostics {
+		fmt.Print(diagnostic.String())
+
+		switch diagnostic.Severity {
+		case SeverityError:
+			errors++
+		case SeverityWarning:
+			warnings++
+		}
+	}
+
+	if errors > 0 {
+		fmt.Printf("%d error(s), %d warning(s)\n", errors, warnings)
+	}
+
+	Diagnostics = nil
+}
+
+// recoverStatement turns an aborted statement back into normal control flow.
+// Any other panic is a compiler bug and keeps going
+func recoverStatement(recovered any) {
+	if recovered == nil {
+		return
+	}
+	if _, aborted := recovered.(abortStatement); !aborted {
+		panic(recovered)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// printed returns what printDiagnostics writes for the diagnostics so far
+func printed(t *testing.T) string {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	printDiagnostics()
+	os.Stdout = stdout
+	writer.Close()
+
+	text, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(text)
+}
+
+func TestEveryBrokenStatementIsReported(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		errors  []string
+		summary string
+	}{
+		{
+			"one per statement",
+			"int a = 1 +\nfunc f() int {\n    int x = \"s\"\n    return 1\n}\nwhile (a < 3) {\n    a = a *\n}\nwrite(a)\nwrite(b)\n",
+			[]string{
+				"test.josh:1:11: error: Expected a value after \"+\"",
+				"test.josh:3:9: error: Type mismatch between x (INT) and \"s\" (STRING)",
+				"test.josh:7:11: error: Expected a value after \"*\"",
+				"test.josh:10:7: error: Previously undeclared variable assignment: b",
+			},
+			"4 error(s), 0 warning(s)\n",
+		},
+		{
+			"lexer and parser",
+			"int a = 1 @\nstring s = \"open\nwrite(a +)\n",
+			[]string{
+				"test.josh:1:11: error: Unrecognized character \"@\"",
+				"test.josh:2:12: error: Unterminated literal, expected closing \"",
+				"test.josh:3:9: error: Expected a value after \"+\"",
+			},
+			"3 error(s), 0 warning(s)\n",
+		},
+		{
+			"in source order",
+			"write(1 +)\nstring s = \"open\n",
+			[]string{
+				"test.josh:1:9: error: Expected a value after \"+\"",
+				"test.josh:2:12: error: Unterminated literal, expected closing \"",
+			},
+			"2 error(s), 0 warning(s)\n",
+		},
+		{
+			"warnings alone",
+			"/// stray\nwrite(1)\n",
+			nil,
+			"",
+		},
+		{
+			"optimizer stops at its first",
+			runtimeValue + "const int c = n\nconst int d = n\n",
+			[]string{"test.josh:6:15: error: The value of const c must be known at compile time"},
+			"1 error(s), 1 warning(s)\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compile(t, test.source)
+			output := printed(t)
+
+			var errors []string
+			for _, line := range strings.Split(output, "\n") {
+				if strings.Contains(line, ": error: ") {
+					errors = append(errors, line)
+				}
+			}
+			if strings.Join(errors, "\n") != strings.Join(test.errors, "\n") {
+				t.Errorf("got errors\n%s\nwant\n%s", strings.Join(errors, "\n"), strings.Join(test.errors, "\n"))
+			}
+			if !strings.HasSuffix(output, test.summary) {
+				t.Errorf("output doesn't end with %q:\n%s", test.summary, output)
+			}
+			if Diagnostics != nil {
+				t.Errorf("diagnostics left after printing: %v", Diagnostics)
+			}
+		})
+	}
+}
+
+func TestSnippets(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		diagnostic Diagnostic
+		text       string
+	}{
+		{
+			"span",
+			"int c = a + b\n",
+			Diagnostic{Severity: SeverityError, Pos: Position{"test.josh", 1, 9, 5}, Message: "broken"},
+			"test.josh:1:9: error: broken\n    1 | int c = a + b\n      |         ^~~~~\n",
+		},
+		{
+			"single column",
+			"int c = a + b\n",
+			Diagnostic{Severity: SeverityWarning, Pos: Position{"test.josh", 1, 11, 0}, Message: "odd"},
+			"test.josh:1:11: warning: odd\n    1 | int c = a + b\n      |           ^\n",
+		},
+		{
+			"span past the end of the line",
+			"int c = a\n",
+			Diagnostic{Severity: SeverityError, Pos: Position{"test.josh", 1, 9, 20}, Message: "broken"},
+			"test.josh:1:9: error: broken\n    1 | int c = a\n      |         ^\n",
+		},
+		{
+			"tabs",
+			"\tint c = a\n",
+			Diagnostic{Severity: SeverityError, Pos: Position{"test.josh", 1, 10, 1}, Message: "broken"},
+			"test.josh:1:10: error: broken\n    1 | \tint c = a\n      | \t        ^\n",
+		},
+		{
+			"later line",
+			"int a\nint a\n",
+			Diagnostic{Severity: SeverityError, Pos: Position{"test.josh", 2, 5, 1}, Message: "again", Notes: []Diagnostic{noteAt(Position{"test.josh", 1, 5, 1}, "first")}},
+			"test.josh:2:5: error: again\n    2 | int a\n      |     ^\ntest.josh:1:5: note: first\n    1 | int a\n      |     ^\n",
+		},
+		{
+			"no position",
+			"",
+			Diagnostic{Severity: SeverityError, Message: "no file"},
+			"error: no file\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetCompiler()
+			lex("test.josh", test.source)
+			if text := test.diagnostic.String(); text != test.text {
+				t.Errorf("got\n%s\nwant\n%s", text, test.text)
+			}
+		})
+	}
+}
+
+func TestErrorsUnderlineTheWholeExpression(t *testing.T) {
+	checkDiagnostics(t, []diagnosticCase{
+		{"assignment", "int x = \"s\"\n", "    1 | int x = \"s\"\n      |     ^~~~~~~\n"},
+		{"operands", "int a = 1\nstring s = \"b\"\nwrite(a + s * 2)\n", "    3 | write(a + s * 2)\n      |           ^~~~~\n"},
+		{"argument", "func f(int v) {\n    write(v)\n}\nf(\"no\" + \"pe\")\n", "    4 | f(\"no\" + \"pe\")\n      |   ^~~~~~~~~~~\n"},
+	})
+}
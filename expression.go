@@ -0,0 +1,787 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// BinaryOperator describes how an infix operator binds and what node it builds.
+// A compound assignment like "+=" also names the arithmetic it expands to
+type BinaryOperator struct {
+	NodeType   string
+	Precedence int
+	RightAssoc bool
+	Compound   string
+}
+
+// higher precedence binds tighter; assignments are the only right associative operators
+var binaryOperators = map[string]BinaryOperator{
+	"=":    {NodeType: "ASSIGN", Precedence: 1, RightAssoc: true},
+	"+=":   {NodeType: "ASSIGN", Precedence: 1, RightAssoc: true, Compound: "ADD"},
+	"-=":   {NodeType: "ASSIGN", Precedence: 1, RightAssoc: true, Compound: "SUB"},
+	"*=":   {NodeType: "ASSIGN", Precedence: 1, RightAssoc: true, Compound: "MULT"},
+	"/=":   {NodeType: "ASSIGN", Precedence: 1, RightAssoc: true, Compound: "DIV"},
+	"%=":   {NodeType: "ASSIGN", Precedence: 1, RightAssoc: true, Compound: "MODULO"},
+	"&=":   {NodeType: "ASSIGN", Precedence: 1, RightAssoc: true, Compound: "BIT_AND"},
+	"|=":   {NodeType: "ASSIGN", Precedence: 1, RightAssoc: true, Compound: "BIT_OR"},
+	"^=":   {NodeType: "ASSIGN", Precedence: 1, RightAssoc: true, Compound: "BIT_XOR"},
+	"<<=":  {NodeType: "ASSIGN", Precedence: 1, RightAssoc: true, Compound: "SHIFT_LEFT"},
+	">>=":  {NodeType: "ASSIGN", Precedence: 1, RightAssoc: true, Compound: "SHIFT_RIGHT"},
+	">>>=": {NodeType: "ASSIGN", Precedence: 1, RightAssoc: true, Compound: "SHIFT_RIGHT_LOGICAL"},
+	"||":   {NodeType: "OR", Precedence: 3},
+	"&&":   {NodeType: "AND", Precedence: 4},
+	"|":    {NodeType: "BIT_OR", Precedence: 5},
+	"^":    {NodeType: "BIT_XOR", Precedence: 6},
+	"&":    {NodeType: "BIT_AND", Precedence: 7},
+	"==":   {NodeType: "EQUALS", Precedence: 8},
+	"!=":   {NodeType: "NOT_EQUAL", Precedence: 8},
+	"<":    {NodeType: "LESS_THAN", Precedence: 9},
+	">":    {NodeType: "GREATER_THAN", Precedence: 9},
+	"<=":   {NodeType: "LESS_THAN_OR_EQUAL_TO", Precedence: 9},
+	">=":   {NodeType: "GREATER_THAN_OR_EQUAL_TO", Precedence: 9},
+	"<<":   {NodeType: "SHIFT_LEFT", Precedence: 10},
+	">>":   {NodeType: "SHIFT_RIGHT", Precedence: 10},
+	">>>":  {NodeType: "SHIFT_RIGHT_LOGICAL", Precedence: 10},
+	"+":    {NodeType: "ADD", Precedence: 11},
+	"-":    {NodeType: "SUB", Precedence: 11},
+	"*":    {NodeType: "MULT", Precedence: 12},
+	"/":    {NodeType: "DIV", Precedence: 12},
+	"%":    {NodeType: "MODULO", Precedence: 12},
+}
+
+// "a ? b : c" binds looser than every operator but assignment
+const ternaryPrecedence = 2
+
+// ExprParser walks the tokens of a single expression
+type ExprParser struct {
+	tokens []Token
+	pos    int
+	root   *Node
+}
+
+// parseExpression parses a whole token slice as one expression that gives a value
+func parseExpression(tokens []Token, root *Node) *Node {
+	node := parseAssignment(tokens, root)
+	if node.Type == "ASSIGN" {
+		rejectAssignment(node)
+	}
+	return node
+}
+
+// parseAssignment parses an expression statement, the only place an
+// assignment can be: "x = 1", "x += 2", "x++" or a call on its own
+func parseAssignment(tokens []Token, root *Node) *Node {
+	if len(tokens) == 0 {
+		errorAt(Position{}, "Expected an expression")
+	}
+
+	// "x++" and "x--" are whole statements, not values
+	last := tokens[len(tokens)-1]
+	if last.Text == "++" || last.Text == "--" {
+		return parseIncrement(tokens[:len(tokens)-1], last, root)
+	}
+
+	parser := ExprParser{tokens: tokens, root: root}
+	node := parser.parseBinary(1)
+
+	if parser.pos < len(tokens) {
+		errorAt(tokens[parser.pos].Position, "Unexpected \""+tokens[parser.pos].Text+"\" in expression")
+	}
+
+	return node
+}
+
+// parseBinary is a precedence climber: it reads an operand, then keeps
+// folding in operators that bind at least as tight as minPrecedence
+func (parser *ExprParser) parseBinary(minPrecedence int) *Node {
+	left := parser.parseUnary()
+
+	for parser.pos < len(parser.tokens) {
+		operatorToken := parser.tokens[parser.pos]
+		if operatorToken.Text == "?" {
+			if ternaryPrecedence < minPrecedence {
+				break
+			}
+			parser.pos++
+			left = parser.parseTernary(operatorToken, left)
+			continue
+		}
+
+		operator, isOperator := binaryOperators[operatorToken.Text]
+		if !isOperator || operatorToken.Kind != "OPERATOR" || operator.Precedence < minPrecedence {
+			break
+		}
+		parser.pos++
+
+		nextPrecedence := operator.Precedence + 1
+		if operator.RightAssoc {
+			nextPrecedence = operator.Precedence
+		}
+
+		if parser.pos >= len(parser.tokens) {
+			errorAt(operatorToken.Position, "Expected a value after \""+operatorToken.Text+"\"")
+		}
+
+		right := parser.parseBinary(nextPrecedence)
+		if operator.Compound != "" {
+			right = compoundValue(operatorToken, left, right, parser.root)
+			operatorToken.Text = "="
+		}
+		left = binaryNode(operator, operatorToken, left, right, parser.root)
+	}
+
+	return left
+}
+
+// parseTernary reads the arms of "condition ? a : b" once the "?" is consumed.
+// The else arm binds like the ternary itself, so "a ? b : c ? d : e" nests to the right
+func (parser *ExprParser) parseTernary(questionToken Token, condition *Node) *Node {
+	if parser.pos >= len(parser.tokens) || parser.tokens[parser.pos].Text == ":" {
+		errorAt(questionToken.Position, "Expected a value after \"?\"")
+	}
+	thenValue := parser.parseBinary(ternaryPrecedence)
+
+	if parser.pos >= len(parser.tokens) || parser.tokens[parser.pos].Text != ":" {
+		errorAt(questionToken.Position, "Missing \":\" for \"?\"")
+	}
+	colonToken := parser.tokens[parser.pos]
+	parser.pos++
+
+	if parser.pos >= len(parser.tokens) {
+		errorAt(colonToken.Position, "Expected a value after \":\"")
+	}
+	elseValue := parser.parseBinary(ternaryPrecedence)
+
+	newNode := Node{
+		Type:   "TERNARY",
+		DType:  thenValue.DType,
+		Value:  "?",
+		Left:   condition,
+		Params: []*Node{thenValue, elseValue},
+		Pos:    questionToken.Position,
+	}
+
+	if condition.DType != "BOOL" {
+		errorAt(spanOf(condition), "Condition of \"?\" must be BOOL, got "+condition.DType)
+	}
+	// arms of different number types both give the wider one
+	if dtype := promotedType(thenValue.DType, elseValue.DType); dtype != "" {
+		thenValue, elseValue = promote(thenValue, dtype), promote(elseValue, dtype)
+		newNode.DType = dtype
+		newNode.Params = []*Node{thenValue, elseValue}
+	}
+	if thenValue.DType != elseValue.DType {
+		errorAt(spanOf(&newNode), "Both arms of \"?:\" must have the same type, got "+thenValue.DType+" and "+elseValue.DType)
+	}
+	if isStructType(thenValue.DType) {
+		errorAt(spanOf(&newNode), "The arms of \"?:\" cannot be structs, pick between their fields instead")
+	}
+	if isArrayValue(thenValue) {
+		errorAt(spanOf(&newNode), "The arms of \"?:\" cannot be arrays, pick between their elements instead")
+	}
+
+	return &newNode
+}
+
+// compoundValue expands the value of "x op= y" to "x op y"
+func compoundValue(operatorToken Token, target *Node, value *Node, root *Node) *Node {
+	if target.Type != "IDENTIFIER" && target.Type != "ARRAY_INDEX" {
+		errorAt(spanOf(target), "Cannot assign to "+target.Value)
+	}
+
+	arithmeticToken := operatorToken
+	arithmeticToken.Text = strings.TrimSuffix(operatorToken.Text, "=")
+
+	return binaryNode(binaryOperators[arithmeticToken.Text], arithmeticToken, deepCopyNode(target), value, root)
+}
+
+// parseIncrement turns "x++" into "x = x + 1" and "x--" into "x = x - 1"
+func parseIncrement(targetTokens []Token, operatorToken Token, root *Node) *Node {
+	if len(targetTokens) == 0 {
+		errorAt(operatorToken.Position, "Expected a variable before \""+operatorToken.Text+"\"")
+	}
+
+	parser := ExprParser{tokens: targetTokens, root: root}
+	target := parser.parsePrimary()
+	if parser.pos < len(targetTokens) {
+		errorAt(targetTokens[parser.pos].Position, "Unexpected \""+targetTokens[parser.pos].Text+"\" before "+operatorToken.Text)
+	}
+
+	if target.Type != "IDENTIFIER" && target.Type != "ARRAY_INDEX" {
+		errorAt(spanOf(target), "Cannot assign to "+target.Value)
+	}
+
+	one := &Node{Type: "INT", DType: "INT", Value: "1", Pos: operatorToken.Position}
+	switch target.DType {
+	case "INT":
+	case "FLOAT":
+		one.Type, one.DType, one.Value = "FLOAT", "FLOAT", "1.0"
+	default:
+		errorAt(spanOf(target), "Cannot apply \""+operatorToken.Text+"\" to "+target.Value+" ("+target.DType+")")
+	}
+
+	arithmeticToken := operatorToken
+	arithmeticToken.Text = operatorToken.Text[:1]
+	value := binaryNode(binaryOperators[arithmeticToken.Text], arithmeticToken, deepCopyNode(target), one, root)
+
+	assignToken := operatorToken
+	assignToken.Text = "="
+	return binaryNode(binaryOperators["="], assignToken, target, value, root)
+}
+
+// parseUnary reads any prefix "-", "!" or "~" and binds them tighter than every infix operator
+func (parser *ExprParser) parseUnary() *Node {
+	token := parser.tokens[parser.pos]
+
+	if token.Kind != "OPERATOR" || (token.Text != "-" && token.Text != "!" && token.Text != "~") {
+		return parser.parsePrimary()
+	}
+	parser.pos++
+
+	if parser.pos >= len(parser.tokens) {
+		errorAt(token.Position, "Expected a value after \""+token.Text+"\"")
+	}
+
+	// "-" right before a number is part of the literal
+	next := parser.tokens[parser.pos]
+	if token.Text == "-" && (next.Kind == "INT" || next.Kind == "FLOAT") {
+		parser.pos++
+		return negativeLiteral(token, next)
+	}
+
+	operand := parser.parseUnary()
+
+	newNode := Node{
+		Value: token.Text,
+		Left:  operand,
+		Pos:   token.Position,
+	}
+
+	switch token.Text {
+	case "-":
+		newNode.Type = "NEGATE"
+		newNode.DType = operand.DType
+
+		if operand.DType != "INT" && operand.DType != "FLOAT" {
+			errorAt(spanOf(&newNode), "Cannot negate "+operand.Value+" ("+operand.DType+")")
+		}
+	case "~":
+		newNode.Type = "BIT_NOT"
+		newNode.DType = "INT"
+
+		if operand.DType != "INT" {
+			errorAt(spanOf(&newNode), "Cannot apply \"~\" to "+operand.Value+" ("+operand.DType+")")
+		}
+	default:
+		newNode.Type = "NOT"
+		newNode.DType = "BOOL"
+
+		if operand.DType != "BOOL" {
+			errorAt(spanOf(&newNode), "Cannot apply \"!\" to "+operand.Value+" ("+operand.DType+")")
+		}
+	}
+
+	return &newNode
+}
+
+// parsePrimary reads a literal, variable, call, index, array literal or
+// parenthesized sub-expression
+func (parser *ExprParser) parsePrimary() *Node {
+	token := parser.tokens[parser.pos]
+
+	switch token.Kind {
+	case "INT", "FLOAT", "STRING", "CHAR", "BOOL":
+		parser.pos++
+		newNode := &Node{
+			Type:  token.Kind,
+			DType: token.Kind,
+			Value: token.Text,
+			Pos:   token.Position,
+		}
+
+		if token.Kind == "INT" {
+			checkIntRange(newNode)
+		}
+		return newNode
+
+	case "IDENTIFIER":
+		next := parser.pos + 1
+		if enumNode := findEnum(token.Text); enumNode != nil && next < len(parser.tokens) && parser.tokens[next].Text == "." {
+			if next+1 >= len(parser.tokens) || enumMember(enumNode, parser.tokens[next+1].Text) == nil {
+				errorAt(parser.tokens[next].Position, "Expected a member of enum "+enumNode.Value+" after \".\"")
+			}
+			member := parser.tokens[next+1]
+
+			pos := token.Position
+			if member.Line == pos.Line {
+				pos.Len = member.Col + member.Len - pos.Col
+			}
+			parser.pos = next + 2
+			return enumValue(enumMember(enumNode, member.Text), pos)
+		}
+
+		if isStructType(token.Text) && next < len(parser.tokens) && parser.tokens[next].Text == "{" {
+			closeIndex := findMatchingToken(parser.tokens, next)
+			if closeIndex == -1 {
+				errorAt(parser.tokens[next].Position, "Missing closing \"}\" for struct literal")
+			}
+
+			literal := parseStructLiteral(parser.tokens[parser.pos:closeIndex+1], parser.root)
+			parser.pos = closeIndex + 1
+			return parser.parseFields(literal)
+		}
+
+		if next < len(parser.tokens) && (parser.tokens[next].Text == "(" || parser.tokens[next].Text == "[") {
+			closeIndex := findMatchingToken(parser.tokens, next)
+			if closeIndex == -1 {
+				errorAt(parser.tokens[next].Position, "Missing closing bracket for \""+parser.tokens[next].Text+"\"")
+			}
+
+			// every index of "m[i][j]" belongs to the same element
+			for parser.tokens[next].Text == "[" && closeIndex+1 < len(parser.tokens) && parser.tokens[closeIndex+1].Text == "[" {
+				if closeIndex = findMatchingToken(parser.tokens, closeIndex+1); closeIndex == -1 {
+					errorAt(parser.tokens[next].Position, "Missing closing bracket for \"[\"")
+				}
+			}
+
+			if token.Text == "len" && parser.tokens[next].Text == "(" {
+				lenNode := parseLen(parser.tokens[parser.pos:closeIndex+1], parser.root)
+				parser.pos = closeIndex + 1
+				return lenNode
+			}
+
+			primaryTokens := parser.tokens[parser.pos : closeIndex+1]
+			parser.pos = closeIndex + 1
+
+			var newNode Node
+			if primaryTokens[1].Text == "(" {
+				newNode = parseFunctionCall(primaryTokens, parser.root)
+			} else {
+				newNode = parseArrayIndex(primaryTokens, parser.root)
+			}
+			return parser.parseFields(&newNode)
+		}
+
+		parser.pos++
+		return parser.parseFields(parseIdentifier(token, parser.root))
+
+	case "KEYWORD":
+		if _, isConversion := conversions[strings.ToUpper(token.Text)]; isConversion && parser.pos+1 < len(parser.tokens) && parser.tokens[parser.pos+1].Text == "(" {
+			closeIndex := findMatchingToken(parser.tokens, parser.pos+1)
+			if closeIndex == -1 {
+				errorAt(parser.tokens[parser.pos+1].Position, "Missing closing \")\" for "+token.Text+"()")
+			}
+
+			conversion := parseConversion(parser.tokens[parser.pos:closeIndex+1], parser.root)
+			parser.pos = closeIndex + 1
+			return conversion
+		}
+
+	case "PUNCTUATION":
+		if token.Text == "(" {
+			closeIndex := findMatchingToken(parser.tokens, parser.pos)
+			if closeIndex == -1 {
+				errorAt(token.Position, "Missing closing \")\"")
+			}
+			if closeIndex == parser.pos+1 {
+				errorAt(token.Position, "Expected an expression inside \"()\"")
+			}
+
+			newNode := parseExpression(parser.tokens[parser.pos+1:closeIndex], parser.root)
+			parser.pos = closeIndex + 1
+			return newNode
+		}
+
+		if token.Text == "{" {
+			closeIndex := findMatchingToken(parser.tokens, parser.pos)
+			if closeIndex == -1 {
+				errorAt(token.Position, "Missing closing \"}\" for array")
+			}
+
+			arrayNode := parseArray(parser.tokens[parser.pos:closeIndex+1], parser.root)
+			parser.pos = closeIndex + 1
+			return &arrayNode
+		}
+	}
+
+	errorAt(token.Position, "Unrecognized character \""+token.Text+"\"")
+	return nil
+}
+
+// parseFields reads any ".field" after an operand. A field of a variable is
+// the variable "p.x" itself, a field of any other struct value is a FIELD_ACCESS
+func (parser *ExprParser) parseFields(base *Node) *Node {
+	for parser.pos < len(parser.tokens) && parser.tokens[parser.pos].Text == "." {
+		dot := parser.tokens[parser.pos]
+		if parser.pos+1 >= len(parser.tokens) || parser.tokens[parser.pos+1].Kind != "IDENTIFIER" {
+			errorAt(dot.Position, "Expected a field name after \".\"")
+		}
+		name := parser.tokens[parser.pos+1]
+
+		structNode := findStruct(base.DType)
+		if structNode == nil {
+			errorAt(spanOf(base), base.Value+" ("+base.DType+") is not a struct, it has no field "+name.Text)
+		}
+		field := structField(structNode, name.Text)
+		if field == nil {
+			errorAt(name.Position, "Struct "+structNode.Value+" has no field "+name.Text)
+		}
+		parser.pos += 2
+
+		pos := base.Pos
+		if name.Line == pos.Line {
+			pos.Len = name.Col + name.Len - pos.Col
+		}
+
+		if base.Type == "IDENTIFIER" {
+			base = &Node{Type: "IDENTIFIER", Value: base.Value + "." + field.Value, DType: field.DType, Pos: pos}
+		} else {
+			base = &Node{Type: "FIELD_ACCESS", Value: field.Value, DType: field.DType, Left: base, Pos: pos}
+		}
+	}
+
+	return base
+}
+
+// conversions lists the types each type can be converted from
+var conversions = map[string][]string{
+	"INT":    {"INT", "FLOAT", "CHAR"},
+	"FLOAT":  {"FLOAT", "INT", "CHAR"},
+	"CHAR":   {"CHAR", "INT"},
+	"STRING": {"STRING", "INT"},
+}
+
+// parseConversion parses "float(x)", "int(f)", "char(n)", "int(c)" or
+// "string(n)" into a CONVERT to the type named, with the value in Left. An
+// enum converts like an int
+func parseConversion(tokens []Token, root *Node) *Node {
+	args := splitArguments(tokens[2 : len(tokens)-1])
+	if len(args) != 1 {
+		errorAt(tokens[1].Position, tokens[0].Text+"() takes exactly one value to convert")
+	}
+	value := parseGeneric(args[0], root)
+
+	newNode := Node{
+		Type:  "CONVERT",
+		DType: strings.ToUpper(tokens[0].Text),
+		Value: tokens[0].Text,
+		Left:  value,
+		Pos:   tokens[0].Position,
+	}
+	if last := tokens[len(tokens)-1]; last.Line == newNode.Pos.Line {
+		newNode.Pos.Len = last.Col + last.Len - newNode.Pos.Col
+	}
+
+	from := value.DType
+	if isEnumType(from) {
+		from = "INT"
+	}
+	if !slices.Contains(conversions[newNode.DType], from) {
+		errorAt(spanOf(&newNode), "Cannot convert "+value.Value+" ("+value.DType+") to "+tokens[0].Text)
+	}
+
+	return &newNode
+}
+
+// negativeLiteral joins a "-" and the number after it into one literal
+func negativeLiteral(minusToken Token, numberToken Token) *Node {
+	newNode := &Node{
+		Type:  numberToken.Kind,
+		DType: numberToken.Kind,
+		Pos:   minusToken.Position,
+	}
+	if numberToken.Line == minusToken.Line {
+		newNode.Pos.Len = numberToken.Col + numberToken.Len - minusToken.Col
+	}
+
+	if numberToken.Kind == "FLOAT" {
+		newNode.Value = "-" + numberToken.Text
+		return newNode
+	}
+
+	value, _ := strconv.Atoi(numberToken.Text)
+	newNode.Value = strconv.Itoa(-value)
+	checkIntRange(newNode)
+	return newNode
+}
+
+// checkIntRange reports an int literal that doesn't fit in a 32-bit MIPS word
+func checkIntRange(literal *Node) {
+	value, err := strconv.ParseInt(literal.Value, 10, 64)
+	if err != nil || value < math.MinInt32 || value > math.MaxInt32 {
+		errorAt(spanOf(literal), "Integer literal "+literal.Value+" does not fit in a 32-bit int")
+	}
+}
+
+func parseIdentifier(token Token, root *Node) *Node {
+	newNode := Node{
+		Type:  "IDENTIFIER",
+		Value: token.Text,
+		Pos:   token.Position,
+	}
+
+	declaration := lookupSymbol(token.Text)
+	if declaration == nil {
+		errorAt(newNode.Pos, "Previously undeclared variable assignment: "+token.Text)
+	}
+
+	// an enum member is its value
+	if declaration.Type == "ENUM_MEMBER" {
+		return enumValue(enumMember(findEnum(declaration.DType), token.Text), newNode.Pos)
+	}
+
+	// a variable that shadows another goes by the name it was given
+	newNode.Value = declaration.Value
+	newNode.DType = declaration.DType
+
+	return &newNode
+}
+
+// binaryNode builds the node for an infix operator and type checks it
+func binaryNode(operator BinaryOperator, operatorToken Token, left *Node, right *Node, root *Node) *Node {
+	newNode := Node{
+		Type:  operator.NodeType,
+		DType: "OP",
+		Value: operatorToken.Text,
+		Left:  left,
+		Right: right,
+		Pos:   operatorToken.Position,
+	}
+
+	// structs are only assigned whole, every other operator works on their fields
+	if operator.NodeType != "ASSIGN" && (isStructType(left.DType) || isStructType(right.DType)) {
+		errorAt(spanOf(&newNode), "Cannot apply \""+newNode.Value+"\" to a struct, only to its fields")
+	}
+	if operator.NodeType != "ASSIGN" && (isArrayValue(left) || isArrayValue(right)) {
+		errorAt(spanOf(&newNode), "Cannot apply \""+newNode.Value+"\" to an array, only to its elements")
+	}
+
+	switch operator.NodeType {
+	case "ASSIGN":
+		// "a = b = 1" stores nothing in a, the inner assignment has no value
+		if right.Type == "ASSIGN" {
+			rejectAssignment(right)
+		}
+		if left.Type != "IDENTIFIER" && left.Type != "ARRAY_INDEX" {
+			errorAt(spanOf(left), "Cannot assign to "+left.Value)
+		}
+		if declaration := lookupSymbol(left.Value); declaration != nil && declaration.Type == "CONST_DECL" {
+			errorAt(spanOf(left), "Cannot assign to const "+left.Value, noteAt(declaration.Pos, left.Value+" is declared const here"))
+		}
+
+		if newNode.Right.Type == "ARRAY" {
+			if !isArrayType(newNode.Left.DType) {
+				errorAt(spanOf(&newNode), "Cannot assign an array literal to "+newNode.Left.Value+" ("+newNode.Left.DType+")")
+			}
+			checkArrayLiteral(newNode.Right, newNode.Left.DType)
+		} else {
+			newNode.Right = widenTo(newNode.Right, newNode.Left.DType)
+			operatorTypeComparison(&newNode, root)
+		}
+
+	case "AND", "OR":
+		newNode.DType = "BOOL"
+
+		if newNode.Left.DType != "BOOL" || newNode.Right.DType != "BOOL" {
+			errorAt(spanOf(&newNode), "\""+newNode.Value+"\" needs BOOL operands, got "+newNode.Left.DType+" and "+newNode.Right.DType)
+		}
+
+	case "BIT_AND", "BIT_OR", "BIT_XOR", "SHIFT_LEFT", "SHIFT_RIGHT", "SHIFT_RIGHT_LOGICAL":
+		newNode.DType = "INT"
+
+		if newNode.Left.DType != "INT" || newNode.Right.DType != "INT" {
+			errorAt(spanOf(&newNode), "\""+newNode.Value+"\" needs INT operands, got "+newNode.Left.DType+" and "+newNode.Right.DType)
+		}
+
+		// MIPS shifts only use the low 5 bits of the count
+		if strings.HasPrefix(operator.NodeType, "SHIFT") && newNode.Right.Type == "INT" {
+			if count, _ := strconv.Atoi(newNode.Right.Value); count < 0 || count > 31 {
+				warningAt(spanOf(newNode.Right), "Shift count "+newNode.Right.Value+" is outside 0 to 31, only its low 5 bits are used")
+			}
+		}
+
+	case "EQUALS", "NOT_EQUAL", "LESS_THAN", "GREATER_THAN", "LESS_THAN_OR_EQUAL_TO", "GREATER_THAN_OR_EQUAL_TO":
+		newNode.DType = "BOOL"
+
+		// numbers of different types are compared in the wider one
+		if dtype := promotedType(newNode.Left.DType, newNode.Right.DType); dtype != "" {
+			newNode.Left = promote(newNode.Left, dtype)
+			newNode.Right = promote(newNode.Right, dtype)
+		}
+
+		// Check that we're comparing compatible types
+		if newNode.Left.DType != newNode.Right.DType {
+			errorAt(spanOf(&newNode), "Cannot compare values of different types: "+newNode.Left.DType+" and "+newNode.Right.DType)
+		}
+
+	default:
+		// enums are only assigned and compared
+		if isEnumType(newNode.Left.DType) || isEnumType(newNode.Right.DType) {
+			errorAt(spanOf(&newNode), "Cannot apply \""+newNode.Value+"\" to an enum, only compare it")
+		}
+
+		// strings are joined with "+"
+		if operator.NodeType == "ADD" && newNode.Left.DType == "STRING" && newNode.Right.DType == "STRING" {
+			newNode.DType = "STRING"
+			break
+		}
+
+		dtype := promotedType(newNode.Left.DType, newNode.Right.DType)
+		if dtype == "" {
+			errorAt(spanOf(&newNode), "Cannot apply \""+newNode.Value+"\" to "+newNode.Left.Value+" ("+newNode.Left.DType+") and "+newNode.Right.Value+" ("+newNode.Right.DType+")")
+		}
+		// arithmetic is done in words, so chars are promoted to int like in C
+		if dtype == "CHAR" {
+			dtype = "INT"
+		}
+		// MIPS has no float remainder
+		if operator.NodeType == "MODULO" && dtype == "FLOAT" {
+			errorAt(spanOf(&newNode), "\"%\" needs INT operands, got "+newNode.Left.DType+" and "+newNode.Right.DType)
+		}
+
+		newNode.Left = promote(newNode.Left, dtype)
+		newNode.Right = promote(newNode.Right, dtype)
+		newNode.DType = dtype
+	}
+
+	return &newNode
+}
+
+// rejectAssignment reports an assignment used where a value is needed
+func rejectAssignment(assignment *Node) {
+	errorAt(spanOf(assignment), "An assignment has no value, assign "+assignment.Left.Value+" in a statement of its own")
+}
+
+// numericRanks orders the numeric types from narrowest to widest. A value
+// is only ever promoted up the order, char to int to float, since every
+// char is an int and every int is a float. Going down loses part of the
+// value, so it has to be asked for with a conversion like int(f)
+var numericRanks = map[string]int{"CHAR": 0, "INT": 1, "FLOAT": 2}
+
+// promotedType is the type two numeric operands are both promoted to, the
+// wider of the two, or "" if either of them isn't a number
+func promotedType(left string, right string) string {
+	leftRank, leftNumeric := numericRanks[left]
+	rightRank, rightNumeric := numericRanks[right]
+	if !leftNumeric || !rightNumeric {
+		return ""
+	}
+	if leftRank > rightRank {
+		return left
+	}
+	return right
+}
+
+// promote converts a numeric value to the wider type dtype with an implicit
+// CONVERT, the same node an explicit conversion builds
+func promote(value *Node, dtype string) *Node {
+	if value.DType == dtype {
+		return value
+	}
+	return &Node{
+		Type:  "CONVERT",
+		DType: dtype,
+		Value: strings.ToLower(dtype),
+		Left:  value,
+		Pos:   value.Pos,
+	}
+}
+
+// widenTo promotes a value stored into a place of type dtype. Storing a
+// number into a narrower type is an error, anything else that doesn't match
+// is left for the caller to report
+func widenTo(value *Node, dtype string) *Node {
+	valueRank, valueNumeric := numericRanks[value.DType]
+	rank, numeric := numericRanks[dtype]
+	if !valueNumeric || !numeric || valueRank == rank {
+		return value
+	}
+	if valueRank > rank {
+		errorAt(spanOf(value), "Cannot implicitly narrow "+describeValue(value)+" to "+dtype+", convert it with "+strings.ToLower(dtype)+"()")
+	}
+	return promote(value, dtype)
+}
+
+// describeValue names a value in an error: a variable or literal by its
+// text, an expression only by its type
+func describeValue(value *Node) string {
+	if value.Left == nil && value.Right == nil {
+		return value.Value + " (" + value.DType + ")"
+	}
+	return "a " + value.DType + " value"
+}
+
+// checkArrayLiteral checks an array literal against the array type it is
+// assigned to. Each element is a value of the element type, or a nested
+// literal for a row. Elements left out are zero
+func checkArrayLiteral(literal *Node, dtype string) {
+	if len(literal.Body) > arrayLength(dtype) {
+		errorAt(spanOf(literal), "Array literal has "+strconv.Itoa(len(literal.Body))+" elements, more than the "+strconv.Itoa(arrayLength(dtype))+" of "+dtype)
+	}
+	literal.DType = dtype
+
+	element := elementType(dtype)
+	for valueIndex, value := range literal.Body {
+		if value.Type == "ARRAY" && isArrayType(element) {
+			checkArrayLiteral(value, element)
+			continue
+		}
+
+		value = widenTo(value, element)
+		if value.DType != element {
+			errorAt(spanOf(value), "Array element "+value.Value+" ("+value.DType+") does not match element type "+element)
+		}
+		literal.Body[valueIndex] = value
+	}
+}
+
+// findMatchingToken returns the index of the bracket closing tokens[openIndex], or -1
+func findMatchingToken(tokens []Token, openIndex int) int {
+	pairs := map[string]string{"(": ")", "[": "]", "{": "}"}
+	open := tokens[openIndex].Text
+	closer := pairs[open]
+
+	count := 0
+	for i := openIndex; i < len(tokens); i++ {
+		if tokens[i].Text == open {
+			count++
+		} else if tokens[i].Text == closer {
+			count--
+			if count == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitArguments splits tokens on the commas that are not nested in brackets
+func splitArguments(tokens []Token) [][]Token {
+	var args [][]Token
+	var currentChunk []Token
+	depth := 0
+
+	for _, token := range tokens {
+		switch token.Text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		}
+
+		if token.Text == "," && depth == 0 {
+			args = append(args, currentChunk)
+			currentChunk = nil
+		} else {
+			currentChunk = append(currentChunk, token)
+		}
+	}
+
+	if len(currentChunk) > 0 {
+		args = append(args, currentChunk)
+	}
+
+	return args
+}
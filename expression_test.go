@@ -0,0 +1,191 @@
+package main
+
+import "testing"
+
+func TestPrecedence(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"product first", "write(1 + 2 * 3)\n", "7"},
+		{"left to right", "write(10 - 4 - 3)\n", "3"},
+		{"division left to right", "write(100 / 10 / 5)\n", "2"},
+		{"modulo with product", "write(7 * 3 % 4)\n", "1"},
+		{"shift after sum", "write(1 << 2 + 1)\n", "8"},
+		{"comparison after shift", "write(1 << 3 > 7)\n", "1"},
+		{"and before or", "write(True || False && False)\n", "1"},
+		{"bitwise after equality", "write((6 & 3) == 2)\n", "1"},
+		{"xor between and and or", "write(1 | 6 ^ 3 & 5)\n", "7"},
+		{"runtime", runtimeValue + "write(n - 1000 - 500 * 2 + n / 4 * 2)\n", "1000"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"missing operand", "int a = 1 +\n", "Expected a value after \"+\""},
+		{"bitwise before equality", "write(6 & 3 == 2)\n", "\"&\" needs INT operands, got INT and BOOL"},
+	})
+}
+
+func TestParenthesesAndUnaryOperators(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"grouping", "write((1 + 2) * 3)\n", "9"},
+		{"nested grouping", "write(((2)) * (3 - (4 - 5)))\n", "8"},
+		{"negate group", "write(-(2 + 3))\n", "-5"},
+		{"double negate", "write(- -4)\n", "4"},
+		{"not", "write(!True)\n", "0"},
+		{"not group", "write(!(1 > 2))\n", "1"},
+		{"complement", "write(~0)\n", "-1"},
+		{"negate float", "write(-2.5 * 2)\n", "-5.0"},
+		{"runtime negate", runtimeValue + "write(-n)\n", "-2000"},
+		{"runtime negate binds tighter", runtimeValue + "write(-n * 2)\n", "-4000"},
+		{"runtime minus negate", runtimeValue + "write(2 - -n)\n", "2002"},
+		{"runtime not", runtimeValue + "write(!(n > 5))\n", "0"},
+		{"runtime complement", runtimeValue + "write(~n)\n", "-2001"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"missing operand", "write(-)\n", "Expected a value after \"-\""},
+		{"not an int", "write(!5)\n", "Cannot apply \"!\" to 5 (INT)"},
+		{"complement a float", "write(~1.5)\n", "Cannot apply \"~\" to 1.5 (FLOAT)"},
+		{"negate a string", "write(-\"a\")\n", "Cannot negate \"a\" (STRING)"},
+		{"empty parentheses", "write(())\n", "Expected an expression inside \"()\""},
+		{"unclosed parenthesis", "int b = (1 + 2\n", "Missing closing \")\""},
+	})
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"arithmetic", "int a = 10\na += 5\na -= 3\na *= 4\na /= 6\na %= 5\nwrite(a)\n", "3"},
+		{"bitwise", "int b = 6\nb &= 3\nb |= 8\nb ^= 1\nb <<= 2\nb >>= 1\nwrite(b)\n", "22"},
+		{"logical shift", "int c = -16\nc >>>= 28\nwrite(c)\n", "15"},
+		{"increment and decrement", "int i = 5\ni++\ni++\ni--\nwrite(i)\n", "6"},
+		{"runtime", runtimeValue + "n += 5\nn--\nn--\nn *= 2\nwrite(n)\n", "4006"},
+		{"float", "float f = 1.5\nf *= 2\nf++\nwrite(f)\n", "4.0"},
+		{"string", "string s = \"a\"\ns += \"b\"\nwrite(s)\n", "ab"},
+		{"array element", "[3]int arr\narr[1] += 7\narr[1]++\nwrite(arr[1])\n", "8"},
+		{"runtime array element", runtimeValue + "[3]int arr\narr[n - 1999] += 7\narr[n - 1999]++\nwrite(arr[1])\n", "8"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"type mismatch", "int a = 1\na += \"s\"\n", "Cannot apply \"+\" to a (INT) and \"s\" (STRING)"},
+		{"string minus", "string s = \"x\"\ns -= \"y\"\n", "Cannot apply \"-\" to s (STRING) and \"y\" (STRING)"},
+		{"increment a string", "string s = \"x\"\ns++\n", "Cannot apply \"++\" to s (STRING)"},
+		{"increment a bool", "bool t = True\nt++\n", "Cannot apply \"++\" to t (BOOL)"},
+		{"increment a literal", "5++\n", "Cannot assign to 5"},
+		{"const", "const int k = 1\nk += 1\n", "Cannot assign to const k"},
+		{"undeclared", "x += 1\n", "Previously undeclared variable assignment: x"},
+	})
+}
+
+func TestTernary(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"folded", "write(True ? 1 : 2)\n", "1"},
+		{"chains to the right", "write(False ? 1 : True ? 2 : 3)\n", "2"},
+		{"binds loosely", "write(1 + 2 > 2 ? 10 : 20)\n", "10"},
+		{"in parentheses", "write(1 + (False ? 10 : 20) * 2)\n", "41"},
+		{"runtime", runtimeValue + "write(1 + (n < 5 ? 10 : 20) * 2)\n", "41"},
+		{"runtime strings", runtimeValue + "string s = n > 5 ? \"big\" : \"small\"\nwrite(s)\n", "big"},
+		{"arms promoted", runtimeValue + "write(n > 5 ? 1 : 2.5)\n", "1.0"},
+		{"runtime chain", runtimeValue + "write(n < 5 ? 1 : n < 5000 ? 2 : 3)\n", "2"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"int condition", "write(1 ? 2 : 3)\n", "Condition of \"?\" must be BOOL, got INT"},
+		{"arm types", "write(True ? 1 : \"a\")\n", "Both arms of \"?:\" must have the same type, got INT and STRING"},
+		{"missing colon", "write(True ? 1)\n", "Missing \":\" for \"?\""},
+		{"missing then", "write(True ? : 2)\n", "Expected a value after \"?\""},
+		{"missing else", "write(True ? 1 :)\n", "Expected a value after \":\""},
+		{"narrowed", "int a = True ? 1 : 2.5\n", "Cannot implicitly narrow a FLOAT value to INT, convert it with int()"},
+	})
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"and", "write(2000 & 0xF0)\n", "208"},
+		{"or", "write(2000 | 1)\n", "2001"},
+		{"xor", "write(6 ^ 3)\n", "5"},
+		{"complement", "write(~2000)\n", "-2001"},
+		{"shift left", "write(2000 << 3)\n", "16000"},
+		{"arithmetic shift", "write(-16 >> 2)\n", "-4"},
+		{"logical shift", "write(-16 >>> 28)\n", "15"},
+		{"shift count wraps", "write(1 << 33)\n", "2"},
+		{"runtime and", runtimeValue + "write(n & 0xF0)\n", "208"},
+		{"runtime or", runtimeValue + "write(n | 1)\n", "2001"},
+		{"runtime xor", runtimeValue + "write(n ^ 2000)\n", "0"},
+		{"runtime complement", runtimeValue + "write(~n)\n", "-2001"},
+		{"runtime shift left", runtimeValue + "write(n << 3)\n", "16000"},
+		{"runtime arithmetic shift", runtimeValue + "write(-n >> 4)\n", "-125"},
+		{"runtime logical shift", runtimeValue + "write(-n >>> 28)\n", "15"},
+		{"runtime shift count wraps", runtimeValue + "write(n << 33)\n", "4000"},
+		{"runtime shift count", runtimeValue + "write(1 << n - 1990)\n", "1024"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"float", "write(1.5 & 1)\n", "\"&\" needs INT operands, got FLOAT and INT"},
+		{"bool", "write(True | False)\n", "\"|\" needs INT operands, got BOOL and BOOL"},
+		{"string", "write(\"a\" << 1)\n", "\"<<\" needs INT operands, got STRING and INT"},
+		{"char", "write('a' ^ 1)\n", "\"^\" needs INT operands, got CHAR and INT"},
+		{"complement a float", "write(~1.5)\n", "Cannot apply \"~\" to 1.5 (FLOAT)"},
+		{"shift count", "write(1 << -1)\n", "warning: Shift count -1 is outside 0 to 31, only its low 5 bits are used"},
+		{"big shift count", "write(1 << 33)\n", "warning: Shift count 33 is outside 0 to 31, only its low 5 bits are used"},
+	})
+}
+
+func TestConversions(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"int to float", "int n = 7\nwrite(float(n) / 2.0)\n", "3.5"},
+		{"float to int rounds", "write(int(2.5))\nwrite(int(3.5))\nwrite(int(-2.7))\n", "24-3"},
+		{"int to char", "write(char(65))\n", "A"},
+		{"char to int", "write(int('a'))\n", "97"},
+		{"int to string", "write(string(42) + \"!\")\nwrite(string(-15))\n", "42!-15"},
+		{"enum to int", "enum Color { Red, Green }\nColor c = Green\nwrite(int(c))\n", "1"},
+		{"runtime int to float", runtimeValue + "float g = float(n) * 1.5\nwrite(g)\nwrite(int(g))\n", "3000.03000"},
+		{"runtime char", runtimeValue + "char c = char(n % 26 + 65)\nwrite(c)\nwrite(int(c) + 1)\n", "Y90"},
+		{"runtime string", runtimeValue + "write(string(n))\nwrite(string(0 - n))\n", "2000-2000"},
+		{"runtime char to float", runtimeValue + "char c = 'c'\nif (n > 5) {\n    c = 'd'\n}\nwrite(float(c) / 2.0)\n", "50.0"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"bool", "bool b = True\nint x = int(b)\n", "Cannot convert b (BOOL) to int"},
+		{"float to string", "string s = string(1.5)\n", "Cannot convert 1.5 (FLOAT) to string"},
+		{"string to char", "char c = char(\"x\")\n", "Cannot convert \"x\" (STRING) to char"},
+		{"two values", "int y = int(1, 2)\n", "int() takes exactly one value to convert"},
+		{"out of range", "int z = int(3.0e10)\nwrite(z)\n", "Cannot convert 30000000000.0 to int, it is outside the 32-bit range"},
+		{"runtime string join", runtimeValue + "write(string(n) + \"!\")\n", "Strings can only be joined when both are known at compile time"},
+	})
+}
+
+func TestNumericPromotion(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"int division then widened", "int n = 7\nfloat f = n / 2\nwrite(f)\n", "3.0"},
+		{"int and float", "int n = 7\nwrite(n / 2.0)\nwrite(1 + 2.5)\n", "3.53.5"},
+		{"char and int", "char c = 'a'\nint code = c + 1\nwrite(code)\nwrite(c < 98)\n", "981"},
+		{"remainder keeps the sign", "write(-7 % 3)\n", "-1"},
+		{"wraps around", "int big = 2147483647 + 1\nwrite(big)\n", "-2147483648"},
+		{"ternary arms", "bool b = True\nfloat pick = b ? 1 : 2.5\nwrite(pick)\n", "1.0"},
+		{"array elements", "[3]float xs = {1, 2.5, 'c' - 'a'}\nwrite(xs[0])\nwrite(xs[2])\n", "1.02.0"},
+		{"runtime int to float", runtimeValue + "float r = n / 3\nwrite(r)\nfloat s = n + 0.5\nwrite(s)\n", "666.02000.5"},
+		{"runtime char and int", runtimeValue + "char c = 'a'\nint q = c + n\nwrite(q)\nwrite(n > 1.5)\n", "20971"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"float to int", "float f = 2.5\nint n = f * 2\n", "Cannot implicitly narrow a FLOAT value to INT, convert it with int()"},
+		{"int to char", "char c = 70\n", "Cannot implicitly narrow 70 (INT) to CHAR, convert it with char()"},
+		{"float remainder", "float f = 2.5\nfloat m = f % 2.0\n", "\"%\" needs INT operands, got FLOAT and FLOAT"},
+		{"bool arithmetic", "bool b = True\nint x = b + 1\n", "Cannot apply \"+\" to b (BOOL) and 1 (INT)"},
+		{"float assigned to int", "int n = 1\nn = 2.5\n", "Cannot implicitly narrow 2.5 (FLOAT) to INT, convert it with int()"},
+	})
+}
+
+func TestLogicalOperators(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"folded and", "write(True && False)\nwrite(True && True)\n", "01"},
+		{"folded or", "write(False || True)\nwrite(False || False)\n", "10"},
+		{"folded condition", "int a = 3\nif (a > 1 && a < 5) {\n    write(\"in\")\n}\n", "in"},
+		{"folded loop", "int i = 0\nwhile (i < 10 && i * i < 20) {\n    i++\n}\nwrite(i)\n", "5"},
+		{"runtime", runtimeValue + "write(n > 1 && n < 5)\nwrite(n < 1 || n == 2000)\n", "01"},
+		{"runtime for", runtimeValue + "int s = 0\nfor (int i = 0; i < n && s < 10; i++) {\n    s = s + i\n}\nwrite(s)\n", "10"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"int operand", "bool a = 1 && True\n", "\"&&\" needs BOOL operands, got INT and BOOL"},
+		{"string operand", "bool a = True || \"x\"\n", "\"||\" needs BOOL operands, got BOOL and STRING"},
+		{"missing operand", "bool a = True &&\n", "Expected a value after \"&&\""},
+	})
+}
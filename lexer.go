@@ -0,0 +1,504 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Position is where a token (or the node built from it) starts in the source.
+// Len is how many columns it covers, for underlining it in diagnostics
+type Position struct {
+	File string
+	Line int
+	Col  int
+	Len  int
+}
+
+func (pos Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", pos.File, pos.Line, pos.Col)
+}
+
+// Token is a single lexeme with its kind and source position
+type Token struct {
+	Kind string
+	Text string
+	Position
+}
+
+var keywords = []string{
+	"func", "global", "const", "return", "struct", "enum",
+	"if", "else", "for", "while", "do", "break", "continue",
+	"switch", "case", "default",
+	"int", "string", "char", "float", "bool",
+}
+
+// operators and punctuation, longest first so "==" wins over "="
+var symbols = []string{
+	">>>=", ">>>", "<<=", ">>=",
+	"==", "!=", ">=", "<=", "&&", "||", "<<", ">>",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "++", "--",
+	"(", ")", "{", "}", "[", "]", ";", ",", ":",
+	"+", "-", "*", "/", "%", "=", "<", ">", "!", "?",
+	"&", "|", "^", "~", ".",
+}
+
+type Lexer struct {
+	file   string
+	source []rune
+	pos    int
+	line   int
+	col    int
+	tokens []Token
+}
+
+// lexFile reads the input file and turns it into tokens
+func lexFile(inputFile string) []Token {
+	source, err := os.ReadFile(inputFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return lex(inputFile, string(source))
+}
+
+func lex(file string, source string) []Token {
+	sourceLines[file] = strings.Split(source, "\n")
+
+	lexer := Lexer{
+		file:   file,
+		source: []rune(source),
+		line:   1,
+		col:    1,
+	}
+
+	for lexer.pos < len(lexer.source) {
+		lexer.next()
+	}
+
+	return lexer.tokens
+}
+
+// next scans one token (or skips whitespace / a comment)
+func (lexer *Lexer) next() {
+	start := lexer.position()
+	char := lexer.peek(0)
+
+	switch {
+	case char == '\n':
+		lexer.advance()
+		lexer.emit("NEWLINE", "\n", start)
+	case unicode.IsSpace(char):
+		lexer.advance()
+	case lexer.hasPrefix("///") && lexer.peek(3) != '/':
+		lexer.emit("DOC", lexer.scanDocComment(), start)
+	case char == '/' && lexer.peek(1) == '/':
+		for lexer.pos < len(lexer.source) && lexer.peek(0) != '\n' {
+			lexer.advance()
+		}
+	case char == '/' && lexer.peek(1) == '*':
+		lexer.skipBlockComment(start)
+	case char == '"':
+		lexer.emit("STRING", lexer.scanQuoted('"', start), start)
+	case char == '\'':
+		lexer.emit("CHAR", lexer.scanQuoted('\'', start), start)
+	case unicode.IsDigit(char):
+		lexer.scanNumber(start)
+	case char == '_' || unicode.IsLetter(char):
+		lexer.scanWord(start)
+	default:
+		for _, symbol := range symbols {
+			if lexer.hasPrefix(symbol) {
+				for range symbol {
+					lexer.advance()
+				}
+				lexer.emit(symbolKind(symbol), symbol, start)
+				return
+			}
+		}
+		// skip the character so the rest of the file is still checked
+		lexer.advance()
+		reportAt(SeverityError, start, "Unrecognized character \""+string(char)+"\"")
+	}
+}
+
+// scanDocComment reads a "///" comment and returns its text
+func (lexer *Lexer) scanDocComment() string {
+	var text strings.Builder
+	for range "///" {
+		lexer.advance()
+	}
+	for lexer.pos < len(lexer.source) && lexer.peek(0) != '\n' {
+		text.WriteRune(lexer.advance())
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// skipBlockComment skips a "/* ... */" comment. One that spans lines still
+// ends the statement it's on, like the newlines inside it would
+func (lexer *Lexer) skipBlockComment(start Position) {
+	lexer.advance()
+	lexer.advance()
+
+	for !lexer.hasPrefix("*/") {
+		if lexer.pos >= len(lexer.source) {
+			// underline the "/*" that is never closed
+			start.Len = 2
+			reportAt(SeverityError, start, "Unterminated block comment, expected closing */")
+			return
+		}
+		lexer.advance()
+	}
+	lexer.advance()
+	lexer.advance()
+
+	if lexer.line != start.Line {
+		lexer.emit("NEWLINE", "\n", lexer.position())
+	}
+}
+
+func (lexer *Lexer) scanWord(start Position) {
+	var word strings.Builder
+	for lexer.pos < len(lexer.source) {
+		char := lexer.peek(0)
+		if char != '_' && !unicode.IsLetter(char) && !unicode.IsDigit(char) {
+			break
+		}
+		word.WriteRune(lexer.advance())
+	}
+
+	text := word.String()
+	switch {
+	case text == "True" || text == "False":
+		lexer.emit("BOOL", text, start)
+	case slices.Contains(keywords, text):
+		lexer.emit("KEYWORD", text, start)
+	default:
+		lexer.emit("IDENTIFIER", text, start)
+	}
+}
+
+// scanNumber reads an int or float literal. Ints can also be written in hex
+// (0x), binary (0b) or octal (0o), floats with an exponent (1.5e3), and _ can
+// separate digits. The token text is the plain decimal value
+func (lexer *Lexer) scanNumber(start Position) {
+	var number strings.Builder
+	kind := "INT"
+
+	readWhile := func(accept func(rune) bool) {
+		for lexer.pos < len(lexer.source) && accept(lexer.peek(0)) {
+			number.WriteRune(lexer.advance())
+		}
+	}
+	isDigitOrSeparator := func(char rune) bool {
+		return char == '_' || unicode.IsDigit(char)
+	}
+
+	if lexer.peek(0) == '0' && strings.ContainsRune("xXbBoO", lexer.peek(1)) {
+		number.WriteRune(lexer.advance())
+		number.WriteRune(lexer.advance())
+	} else {
+		readWhile(isDigitOrSeparator)
+
+		if lexer.peek(0) == '.' && unicode.IsDigit(lexer.peek(1)) {
+			kind = "FLOAT"
+			number.WriteRune(lexer.advance())
+			readWhile(isDigitOrSeparator)
+		}
+
+		exponentSign := lexer.peek(1) == '+' || lexer.peek(1) == '-'
+		if (lexer.peek(0) == 'e' || lexer.peek(0) == 'E') && (unicode.IsDigit(lexer.peek(1)) || (exponentSign && unicode.IsDigit(lexer.peek(2)))) {
+			kind = "FLOAT"
+			number.WriteRune(lexer.advance())
+			number.WriteRune(lexer.advance())
+			readWhile(isDigitOrSeparator)
+		}
+	}
+
+	// letters or digits running on are part of the literal, and make it invalid
+	readWhile(func(char rune) bool {
+		return char == '_' || unicode.IsLetter(char) || unicode.IsDigit(char)
+	})
+
+	text, err := numberValue(number.String(), kind)
+	if err != nil {
+		span := start
+		span.Len = lexer.col - start.Col
+		reportAt(SeverityError, span, err.Error())
+
+		text = "0"
+		if kind == "FLOAT" {
+			text = "0.0"
+		}
+	}
+
+	lexer.emit(kind, text, start)
+}
+
+// numberValue checks a number literal and returns its value as plain decimal
+// text. A decimal int may be one past the largest int, as only a "-" in front
+// of it, which the parser checks for, makes it fit. Hex, binary and octal give
+// the bits of a 32-bit word, so 0xFFFFFFFF is -1
+func numberValue(literal string, kind string) (string, error) {
+	isDigitOrLetter := func(char byte) bool {
+		return unicode.IsDigit(rune(char)) || unicode.IsLetter(rune(char))
+	}
+	for i := 0; i < len(literal); i++ {
+		if literal[i] == '_' && (i == 0 || i == len(literal)-1 || !isDigitOrLetter(literal[i-1]) || !isDigitOrLetter(literal[i+1])) {
+			return "", fmt.Errorf("Misplaced \"_\" in number literal %s, it can only separate digits", literal)
+		}
+	}
+	digits := strings.ReplaceAll(literal, "_", "")
+
+	if kind == "FLOAT" {
+		value, err := strconv.ParseFloat(digits, 32)
+		if errors.Is(err, strconv.ErrRange) {
+			return "", fmt.Errorf("Float literal %s does not fit in a 32-bit float", literal)
+		}
+		if err != nil {
+			return "", fmt.Errorf("Invalid float literal %s", literal)
+		}
+
+		text := strconv.FormatFloat(value, 'f', -1, 32)
+		if !strings.Contains(text, ".") {
+			text += ".0"
+		}
+		return text, nil
+	}
+
+	base := 10
+	if len(digits) > 1 && digits[0] == '0' {
+		switch unicode.ToLower(rune(digits[1])) {
+		case 'x':
+			base = 16
+		case 'b':
+			base = 2
+		case 'o':
+			base = 8
+		}
+	}
+	if base != 10 {
+		digits = digits[2:]
+	}
+
+	value, err := strconv.ParseUint(digits, base, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return "", fmt.Errorf("Invalid number literal %s", literal)
+	}
+
+	if base == 10 {
+		if err != nil || value > -math.MinInt32 {
+			return "", fmt.Errorf("Integer literal %s does not fit in a 32-bit int", literal)
+		}
+		return strconv.FormatUint(value, 10), nil
+	}
+
+	if err != nil || value > math.MaxUint32 {
+		return "", fmt.Errorf("Integer literal %s does not fit in a 32-bit word", literal)
+	}
+	return strconv.Itoa(int(int32(uint32(value)))), nil
+}
+
+// scanQuoted reads a string or char literal and decodes its escape
+// sequences. The result keeps its quotes
+func (lexer *Lexer) scanQuoted(quote rune, start Position) string {
+	var raw strings.Builder
+	lexer.advance()
+
+	// a literal already reported as broken isn't also checked for its length
+	broken := false
+
+	for {
+		if lexer.pos >= len(lexer.source) || lexer.peek(0) == '\n' {
+			broken = true
+			break
+		}
+		char := lexer.advance()
+		if char == quote {
+			break
+		}
+		raw.WriteRune(char)
+
+		// the escaped character can't end the literal
+		if char == '\\' && lexer.pos < len(lexer.source) && lexer.peek(0) != '\n' {
+			raw.WriteRune(lexer.advance())
+		}
+	}
+
+	// errors underline the whole literal, which never spans lines
+	span := start
+	span.Len = lexer.col - start.Col
+	if broken {
+		reportAt(SeverityError, span, "Unterminated literal, expected closing "+string(quote))
+	}
+
+	content, err := decodeEscapes(raw.String())
+	if err != nil {
+		reportAt(SeverityError, span, err.Error())
+		broken = true
+	}
+
+	if quote == '\'' && len(content) != 1 && !broken {
+		reportAt(SeverityError, span, "Char literal must hold exactly one character, got '"+raw.String()+"'")
+	}
+
+	return string(quote) + content + string(quote)
+}
+
+// simpleEscapes maps the character after a backslash to the byte it stands
+// for. \xNN, two hex digits, is the only other escape
+var simpleEscapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'\\': '\\',
+	'"':  '"',
+	'\'': '\'',
+	'0':  0,
+}
+
+// decodeEscapes replaces the escape sequences in the text between a literal's quotes
+func decodeEscapes(raw string) (string, error) {
+	var decoded strings.Builder
+
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			decoded.WriteByte(raw[i])
+			continue
+		}
+
+		if i+1 >= len(raw) {
+			return decoded.String(), fmt.Errorf("Unfinished escape sequence at the end of literal")
+		}
+		i++
+
+		if escaped, exists := simpleEscapes[raw[i]]; exists {
+			decoded.WriteByte(escaped)
+			continue
+		}
+
+		if raw[i] == 'x' {
+			if i+2 >= len(raw) {
+				return decoded.String(), fmt.Errorf("Escape sequence \\x needs two hex digits")
+			}
+			value, err := strconv.ParseUint(raw[i+1:i+3], 16, 8)
+			if err != nil {
+				return decoded.String(), fmt.Errorf("Escape sequence \\x needs two hex digits, got \"%s\"", raw[i+1:i+3])
+			}
+			decoded.WriteByte(byte(value))
+			i += 2
+			continue
+		}
+
+		return decoded.String(), fmt.Errorf("Unknown escape sequence \\%c", raw[i])
+	}
+
+	return decoded.String(), nil
+}
+
+// quoteLiteral turns a decoded string or char literal back into source form,
+// escaping anything that isn't printable ASCII so it survives the TAC file
+func quoteLiteral(literal string) string {
+	quote := literal[0]
+	content := literal[1 : len(literal)-1]
+
+	var quoted strings.Builder
+	quoted.WriteByte(quote)
+	for i := 0; i < len(content); i++ {
+		char := content[i]
+		switch {
+		case char == '\n':
+			quoted.WriteString("\\n")
+		case char == '\t':
+			quoted.WriteString("\\t")
+		case char == 0:
+			quoted.WriteString("\\0")
+		case char == '\\' || char == quote:
+			quoted.WriteByte('\\')
+			quoted.WriteByte(char)
+		case char < 0x20 || char >= 0x7f:
+			quoted.WriteString(fmt.Sprintf("\\x%02x", char))
+		default:
+			quoted.WriteByte(char)
+		}
+	}
+	quoted.WriteByte(quote)
+
+	return quoted.String()
+}
+
+// unquoteLiteral is the inverse of quoteLiteral, giving the literal's content without quotes
+func unquoteLiteral(quoted string) string {
+	content, _ := decodeEscapes(quoted[1 : len(quoted)-1])
+	return content
+}
+
+func (lexer *Lexer) emit(kind string, text string, start Position) {
+	start.Len = lexer.col - start.Col
+	if lexer.line != start.Line {
+		start.Len = 1
+	}
+	lexer.tokens = append(lexer.tokens, Token{Kind: kind, Text: text, Position: start})
+}
+
+func (lexer *Lexer) position() Position {
+	return Position{File: lexer.file, Line: lexer.line, Col: lexer.col}
+}
+
+func (lexer *Lexer) peek(offset int) rune {
+	if lexer.pos+offset >= len(lexer.source) {
+		return 0
+	}
+	return lexer.source[lexer.pos+offset]
+}
+
+func (lexer *Lexer) advance() rune {
+	char := lexer.source[lexer.pos]
+	lexer.pos++
+	if char == '\n' {
+		lexer.line++
+		lexer.col = 1
+	} else {
+		lexer.col++
+	}
+	return char
+}
+
+func (lexer *Lexer) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(string(lexer.source[lexer.pos:min(lexer.pos+len(prefix), len(lexer.source))]), prefix)
+}
+
+func symbolKind(symbol string) string {
+	switch symbol {
+	case "(", ")", "{", "}", "[", "]", ";", ",", ":", ".":
+		return "PUNCTUATION"
+	}
+	return "OPERATOR"
+}
+
+// indexToken returns the index of the first token with the given text, or -1
+func indexToken(tokens []Token, text string) int {
+	for i, token := range tokens {
+		if token.Text == text {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsToken(tokens []Token, text string) bool {
+	return indexToken(tokens, text) != -1
+}
+
+func joinTokens(tokens []Token) string {
+	var joined strings.Builder
+	for _, token := range tokens {
+		joined.WriteString(token.Text)
+	}
+	return joined.String()
+}
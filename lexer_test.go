@@ -0,0 +1,197 @@
+package main
+
+import "testing"
+
+func TestTokensCarryTheirPosition(t *testing.T) {
+	at := func(line int, col int, length int) Position {
+		return Position{File: "test.josh", Line: line, Col: col, Len: length}
+	}
+	tests := []struct {
+		name   string
+		source string
+		tokens []Token
+	}{
+		{"declaration", "int count = 10\n", []Token{
+			{"KEYWORD", "int", at(1, 1, 3)},
+			{"IDENTIFIER", "count", at(1, 5, 5)},
+			{"OPERATOR", "=", at(1, 11, 1)},
+			{"INT", "10", at(1, 13, 2)},
+			{"NEWLINE", "\n", at(1, 15, 1)},
+		}},
+		{"longest operator", "a >>>= b>=c\n", []Token{
+			{"IDENTIFIER", "a", at(1, 1, 1)},
+			{"OPERATOR", ">>>=", at(1, 3, 4)},
+			{"IDENTIFIER", "b", at(1, 8, 1)},
+			{"OPERATOR", ">=", at(1, 9, 2)},
+			{"IDENTIFIER", "c", at(1, 11, 1)},
+			{"NEWLINE", "\n", at(1, 12, 1)},
+		}},
+		{"second line", "write(x)\n  f(True, 'a', \"s\")", []Token{
+			{"IDENTIFIER", "write", at(1, 1, 5)},
+			{"PUNCTUATION", "(", at(1, 6, 1)},
+			{"IDENTIFIER", "x", at(1, 7, 1)},
+			{"PUNCTUATION", ")", at(1, 8, 1)},
+			{"NEWLINE", "\n", at(1, 9, 1)},
+			{"IDENTIFIER", "f", at(2, 3, 1)},
+			{"PUNCTUATION", "(", at(2, 4, 1)},
+			{"BOOL", "True", at(2, 5, 4)},
+			{"PUNCTUATION", ",", at(2, 9, 1)},
+			{"CHAR", "'a'", at(2, 11, 3)},
+			{"PUNCTUATION", ",", at(2, 14, 1)},
+			{"STRING", "\"s\"", at(2, 16, 3)},
+			{"PUNCTUATION", ")", at(2, 19, 1)},
+		}},
+		{"comments", "x // note\ny /* a\nb */ z\n", []Token{
+			{"IDENTIFIER", "x", at(1, 1, 1)},
+			{"NEWLINE", "\n", at(1, 10, 1)},
+			{"IDENTIFIER", "y", at(2, 1, 1)},
+			{"NEWLINE", "\n", at(3, 5, 0)},
+			{"IDENTIFIER", "z", at(3, 6, 1)},
+			{"NEWLINE", "\n", at(3, 7, 1)},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetCompiler()
+			tokens := lex("test.josh", test.source)
+			if len(tokens) != len(test.tokens) {
+				t.Fatalf("got %d tokens, want %d", len(tokens), len(test.tokens))
+			}
+			for i, token := range tokens {
+				if want := test.tokens[i]; token != want {
+					t.Errorf("token %d is %s %q at %d:%d+%d, want %s %q at %d:%d+%d", i,
+						token.Kind, token.Text, token.Line, token.Col, token.Len, want.Kind, want.Text, want.Line, want.Col, want.Len)
+				}
+			}
+			if len(Diagnostics) != 0 {
+				t.Errorf("unexpected diagnostics: %v", Diagnostics)
+			}
+		})
+	}
+}
+
+func TestUnrecognizedCharacter(t *testing.T) {
+	resetCompiler()
+	tokens := lex("test.josh", "a @ b\n")
+	if len(Diagnostics) != 1 || Diagnostics[0].Message != "Unrecognized character \"@\"" || Diagnostics[0].Pos != (Position{"test.josh", 1, 3, 0}) {
+		t.Errorf("got diagnostics %v", Diagnostics)
+	}
+	// the rest of the line is still lexed
+	if len(tokens) != 3 || tokens[1].Text != "b" {
+		t.Errorf("got tokens %v", tokens)
+	}
+}
+
+func TestLiteralErrorsSpanTheLiteral(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		message string
+		pos     Position
+	}{
+		{"unknown escape", "string s = \"ab\\q\"\n", "Unknown escape sequence \\q", Position{"test.josh", 1, 12, 6}},
+		{"unterminated", "string s = \"open\n", "Unterminated literal, expected closing \"", Position{"test.josh", 1, 12, 5}},
+		{"unterminated at the end", "string s = \"open", "Unterminated literal, expected closing \"", Position{"test.josh", 1, 12, 5}},
+		{"long char", "char c = 'ab'\n", "Char literal must hold exactly one character, got 'ab'", Position{"test.josh", 1, 10, 4}},
+		{"empty char", "char c = ''\n", "Char literal must hold exactly one character, got ''", Position{"test.josh", 1, 10, 2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetCompiler()
+			lex("test.josh", test.source)
+			if len(Diagnostics) != 1 {
+				t.Fatalf("got %d diagnostics, want 1: %v", len(Diagnostics), Diagnostics)
+			}
+			if diagnostic := Diagnostics[0]; diagnostic.Message != test.message || diagnostic.Pos != test.pos {
+				t.Errorf("got %q at %+v, want %q at %+v", diagnostic.Message, diagnostic.Pos, test.message, test.pos)
+			}
+		})
+	}
+}
+
+func TestEscapeSequences(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"tab and newline", "write(\"a\\tb\\n\")\n", "a\tb\n"},
+		{"quotes and backslash", "write(\"\\\"q\\\" \\\\ \\'\")\n", "\"q\" \\ '"},
+		{"hex", "write(\"\\x41\\x62\")\n", "Ab"},
+		{"hex char", "write('\\x42')\n", "B"},
+		{"quote char", "write('\\'')\n", "'"},
+		{"newline char", "write('\\n')\n", "\n"},
+		{"zero char", "write(int('\\0'))\n", "0"},
+		{"high byte", "write(int('\\xff'))\n", "255"},
+		{"in a comparison", "write(\"a\\x62\" == \"ab\")\n", "1"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"unknown", "write('\\q')\n", "Unknown escape sequence \\q"},
+		{"bad hex", "write(\"\\xZZ\")\n", "Escape sequence \\x needs two hex digits, got \"ZZ\""},
+		{"short hex", "write(\"\\x4\")\n", "Escape sequence \\x needs two hex digits"},
+		{"escaped closing quote", "write(\"ab\\\")\n", "Unterminated literal, expected closing \""},
+	})
+}
+
+func TestComments(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"line", "write(1) // one\n// write(2)\nwrite(3)\n", "13"},
+		{"block in a line", "int a = 1 /* one */ + 2\nwrite(a)\n", "3"},
+		{"block ends the line", "write(1) /* spans\nlines */ write(2)\n", "12"},
+		{"block of stars", "/** also block */\nwrite(1)\n", "1"},
+		{"four slashes", "//// not a doc\nwrite(1)\n", "1"},
+		{"doc comment", "/// the answer\nglobal int a = 42\nwrite(a)\n", "42"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"unterminated", "write(1)\n/* never ends\n", "test.josh:2:1: error: Unterminated block comment, expected closing */\n    2 | /* never ends\n      | ^~\n"},
+		{"stray doc", "/// stray\nwrite(1)\n", "test.josh:1:1: warning: Doc comment is not followed by a function or global declaration"},
+		{"doc at the end", "write(1)\n/// last\n", "test.josh:2:1: warning: Doc comment is not followed by a function or global declaration"},
+	})
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		literal string
+		kind    string
+		text    string
+	}{
+		{"42", "INT", "42"},
+		{"0xFF", "INT", "255"},
+		{"0X7fff_ffff", "INT", "2147483647"},
+		{"0xFFFFFFFF", "INT", "-1"},
+		{"0b1010", "INT", "10"},
+		{"0o17", "INT", "15"},
+		{"1_000_000", "INT", "1000000"},
+		{"2147483648", "INT", "2147483648"},
+		{"1.25", "FLOAT", "1.25"},
+		{"1.5e3", "FLOAT", "1500.0"},
+		{"25E-1", "FLOAT", "2.5"},
+	}
+	for _, test := range tests {
+		t.Run(test.literal, func(t *testing.T) {
+			resetCompiler()
+			tokens := lex("test.josh", test.literal)
+			if len(Diagnostics) != 0 || len(tokens) != 1 || tokens[0].Kind != test.kind || tokens[0].Text != test.text {
+				t.Errorf("got tokens %v and diagnostics %v, want %s %s", tokens, Diagnostics, test.kind, test.text)
+			}
+		})
+	}
+
+	checkOutput(t, []outputCase{
+		{"hex", "write(0xFF + 0b1 + 0o10)\n", "264"},
+		{"smallest int", "write(-2147483648)\n", "-2147483648"},
+		{"negative", "write(-5 + 3)\n", "-2"},
+		{"minus negative", "write(2 - -3)\n", "5"},
+		{"word", "write(0xFFFFFFFF)\n", "-1"},
+		{"exponent", "write(1.5e3)\n", "1500.0"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"too big", "write(2147483648)\n", "Integer literal 2147483648 does not fit in a 32-bit int"},
+		{"too big word", "write(0x1_0000_0000)\n", "Integer literal 0x1_0000_0000 does not fit in a 32-bit word"},
+		{"bad digit", "write(0b102)\n", "Invalid number literal 0b102"},
+		{"no digits", "write(0x)\n", "Invalid number literal 0x"},
+		{"letters", "write(12abc)\n", "Invalid number literal 12abc"},
+		{"doubled separator", "write(1__0)\n", "Misplaced \"_\" in number literal 1__0, it can only separate digits"},
+		{"trailing separator", "write(1_)\n", "Misplaced \"_\" in number literal 1_, it can only separate digits"},
+		{"too big float", "write(1e99)\n", "Float literal 1e99 does not fit in a 32-bit float"},
+	})
+}
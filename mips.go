@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -14,6 +16,15 @@ type TacInstruction struct {
 	arg1   string
 	arg2   string
 	result string
+	cases  []TacCase
+	fields []string
+	size   int
+}
+
+// One case of a switch instruction: where to jump for a value
+type TacCase struct {
+	value int
+	label string
 }
 
 // Parses TAC input lines into TacInstruction structs
@@ -21,19 +32,97 @@ func parseTAC(lines []string) []TacInstruction {
 	var instructions []TacInstruction
 
 	// Regular expression to split the line into tokens, ignoring spaces inside quotes
-	re := regexp.MustCompile(`"(.*?)"|\S+`) // Match anything inside quotes or non-space characters
+	re := regexp.MustCompile(`"(\\.|[^"\\])*"|'(\\.|[^'\\])*'|\S+`) // Match a quoted literal (escapes included) or non-space characters
 
 	for _, line := range lines {
 		// Find all matches using the regex
 		tokens := re.FindAllString(line, -1)
+		if len(tokens) == 0 {
+			continue
+		}
 
-		// Handle TAC format: var = value or call function arg
-		if len(tokens) == 3 && tokens[1] == "=" {
+		// Handle TAC format: var = value, var = a op b, var = op a, labels, jumps or call function arg
+		if len(tokens) == 3 && tokens[1] == "=" && isElement(tokens[2]) {
+			array, index := splitElement(tokens[2])
+			instructions = append(instructions, TacInstruction{
+				op:     "load",
+				arg1:   array,
+				arg2:   index,
+				result: tokens[0],
+			})
+		} else if len(tokens) == 3 && tokens[1] == "=" && isElement(tokens[0]) {
+			array, index := splitElement(tokens[0])
+			instructions = append(instructions, TacInstruction{
+				op:     "store",
+				arg1:   tokens[2],
+				arg2:   index,
+				result: array,
+			})
+		} else if len(tokens) == 3 && tokens[1] == "=" {
 			instructions = append(instructions, TacInstruction{
 				op:     "=",
 				arg1:   tokens[2],
 				result: tokens[0],
 			})
+		} else if len(tokens) == 5 && tokens[1] == "=" {
+			instructions = append(instructions, TacInstruction{
+				op:     tokens[3],
+				arg1:   tokens[2],
+				arg2:   tokens[4],
+				result: tokens[0],
+			})
+		} else if len(tokens) == 4 && tokens[1] == "=" {
+			op := "neg"
+			switch tokens[2] {
+			case "!":
+				op = "not"
+			case "~":
+				op = "bitnot"
+			case "int", "float", "char", "string":
+				// converts to the type of the result
+				op = "convert"
+			}
+			instructions = append(instructions, TacInstruction{
+				op:     op,
+				arg1:   tokens[3],
+				result: tokens[0],
+			})
+		} else if tokens[0] == "label" || tokens[0] == "goto" {
+			instructions = append(instructions, TacInstruction{
+				op:     tokens[0],
+				result: tokens[1],
+			})
+		} else if tokens[0] == "if" || tokens[0] == "ifFalse" {
+			instructions = append(instructions, TacInstruction{
+				op:     tokens[0],
+				arg1:   tokens[1],
+				result: tokens[3],
+			})
+		} else if tokens[0] == "switch" {
+			instr := TacInstruction{
+				op:     "switch",
+				arg1:   tokens[1],
+				result: tokens[2],
+			}
+			for _, switchCase := range tokens[3:] {
+				value, label, _ := strings.Cut(switchCase, ":")
+				caseValue, _ := strconv.Atoi(value)
+				instr.cases = append(instr.cases, TacCase{value: caseValue, label: label})
+			}
+			instructions = append(instructions, instr)
+		} else if tokens[0] == "array" {
+			size, _ := strconv.Atoi(tokens[2])
+			instructions = append(instructions, TacInstruction{
+				op:     "array",
+				result: tokens[1],
+				size:   size,
+			})
+		} else if tokens[0] == "struct" {
+			instructions = append(instructions, TacInstruction{
+				op:     "struct",
+				result: tokens[1],
+				fields: tokens[2:],
+			})
 		} else if tokens[0] == "call" {
 			instructions = append(instructions, TacInstruction{
 				op:   "call",
@@ -45,6 +134,18 @@ func parseTAC(lines []string) []TacInstruction {
 	return instructions
 }
 
+// isElement tells an array element, "var_a_INT[opt_t1_INT]", apart from a
+// name or a literal
+func isElement(arg string) bool {
+	return isTacName(arg) && strings.HasSuffix(arg, "]")
+}
+
+// Splits an array element into the array and the tempVar or variable holding the index
+func splitElement(arg string) (string, string) {
+	array, index, _ := strings.Cut(strings.TrimSuffix(arg, "]"), "[")
+	return array, index
+}
+
 // Extracts the type from a variable name, e.g., "opt_t1_STRING" -> "STRING"
 func extractTypeFromVar(varName string) string {
 	parts := strings.Split(varName, "_")
@@ -59,6 +160,341 @@ func determineTypeFromVar(tempVar string) string {
 	return extractTypeFromVar(tempVar)
 }
 
+// isTacName tells a tempVar or variable apart from a literal value
+func isTacName(arg string) bool {
+	return strings.HasPrefix(arg, "opt_t") || strings.HasPrefix(arg, "var_")
+}
+
+// Integer (and bool / char) instructions for each TAC operator
+var intOps = map[string]string{
+	"+": "add", "-": "sub", "*": "mul", "/": "div", "%": "rem",
+	"==": "seq", "!=": "sne", "<": "slt", ">": "sgt", "<=": "sle", ">=": "sge",
+	"&": "and", "|": "or", "^": "xor",
+}
+
+// Shift instructions for each TAC operator, taking a constant count or one in a register
+type ShiftOp struct {
+	immediate string
+	variable  string
+}
+
+var shiftOps = map[string]ShiftOp{
+	"<<":  {immediate: "sll", variable: "sllv"},
+	">>":  {immediate: "sra", variable: "srav"},
+	">>>": {immediate: "srl", variable: "srlv"},
+}
+
+// Int tempVars holding a constant, by name
+var intConstants = make(map[string]int)
+
+// Float arithmetic instructions for each TAC operator
+var floatOps = map[string]string{
+	"+": "add.s", "-": "sub.s", "*": "mul.s", "/": "div.s",
+}
+
+// Writes the data declaration for name, initialized to value if it is a literal
+func declareData(mipsCode *strings.Builder, name string, value string) {
+	switch determineTypeFromVar(name) {
+	case "STRING":
+		if strings.HasPrefix(value, "\"") {
+			stringConstants[name] = true
+			mipsCode.WriteString(fmt.Sprintf("%s: %s\n", name, asciizData(unquoteLiteral(value))))
+		} else {
+			mipsCode.WriteString(fmt.Sprintf("%s: .word 0\n", name))
+		}
+	case "CHAR":
+		if value == "" {
+			value = "0"
+		} else if strings.HasPrefix(value, "'") {
+			value = byteData(unquoteLiteral(value)[0])
+		}
+		mipsCode.WriteString(fmt.Sprintf("%s: .byte %s\n", name, value))
+	case "BOOL":
+		boolVal := 0
+		if value == "True" || value == "TRUE" {
+			boolVal = 1
+		}
+		mipsCode.WriteString(fmt.Sprintf("%s: .word %d\n", name, boolVal))
+	case "FLOAT":
+		if value == "" {
+			value = "0.0"
+		}
+		mipsCode.WriteString(fmt.Sprintf("%s: .float %s\n", name, value))
+	case "INT":
+		if value == "" {
+			value = "0"
+		}
+		mipsCode.WriteString(fmt.Sprintf("%s: .word %s\n", name, value))
+	}
+}
+
+// Encodes a string for the .data section. Escapes every assembler
+// understands stay in an .asciiz, anything else falls back to raw bytes
+func asciizData(content string) string {
+	var asciiz strings.Builder
+	for i := 0; i < len(content); i++ {
+		char := content[i]
+		switch {
+		case char == '\n':
+			asciiz.WriteString("\\n")
+		case char == '\t':
+			asciiz.WriteString("\\t")
+		case char == '"' || char == '\\':
+			asciiz.WriteByte('\\')
+			asciiz.WriteByte(char)
+		case char < 0x20 || char >= 0x7f:
+			bytes := []string{}
+			for j := 0; j < len(content); j++ {
+				bytes = append(bytes, strconv.Itoa(int(content[j])))
+			}
+			return ".byte " + strings.Join(append(bytes, "0"), ", ")
+		default:
+			asciiz.WriteByte(char)
+		}
+	}
+	return ".asciiz \"" + asciiz.String() + "\""
+}
+
+// Encodes a char for .byte, quoted when it is plainly printable
+func byteData(char byte) string {
+	if char >= 0x20 && char < 0x7f && char != '\'' && char != '\\' {
+		return "'" + string(char) + "'"
+	}
+	return strconv.Itoa(int(char))
+}
+
+// A switch gets a jump table when its cases fill at least half of the range
+// between the smallest and the largest; sparser ones compare case by case
+func isDenseSwitch(instr TacInstruction) bool {
+	if len(instr.cases) < 3 {
+		return false
+	}
+	low, high := switchRange(instr)
+	return high-low+1 <= 2*len(instr.cases)
+}
+
+func switchRange(instr TacInstruction) (int, int) {
+	low, high := instr.cases[0].value, instr.cases[0].value
+	for _, switchCase := range instr.cases {
+		low = min(low, switchCase.value)
+		high = max(high, switchCase.value)
+	}
+	return low, high
+}
+
+// Writes the jump table of a dense switch: one label per value from low to high
+func declareJumpTable(mipsCode *strings.Builder, name string, instr TacInstruction) {
+	low, high := switchRange(instr)
+	targets := make([]string, high-low+1)
+	for i := range targets {
+		targets[i] = instr.result
+	}
+	for _, switchCase := range instr.cases {
+		targets[switchCase.value-low] = switchCase.label
+	}
+	mipsCode.WriteString(fmt.Sprintf("%s: .word %s\n", name, strings.Join(targets, ", ")))
+}
+
+// Generates the jump to the case matching the switch value, or to the default
+func generateSwitch(mipsCode *strings.Builder, name string, instr TacInstruction) {
+	loadWord(mipsCode, "$t0", instr.arg1)
+
+	if !isDenseSwitch(instr) {
+		for _, switchCase := range instr.cases {
+			mipsCode.WriteString(fmt.Sprintf("li $t1, %d\nbeq $t0, $t1, %s\n", switchCase.value, switchCase.label))
+		}
+		mipsCode.WriteString(fmt.Sprintf("j %s\n", instr.result))
+		return
+	}
+
+	// index the table by value - low; the unsigned compare also catches values below low
+	low, high := switchRange(instr)
+	mipsCode.WriteString(fmt.Sprintf("li $t1, %d\nsub $t0, $t0, $t1\n", low))
+	mipsCode.WriteString(fmt.Sprintf("sltiu $t1, $t0, %d\nbeqz $t1, %s\n", high-low+1, instr.result))
+	mipsCode.WriteString(fmt.Sprintf("sll $t0, $t0, 2\nla $t1, %s\nadd $t0, $t0, $t1\nlw $t1, 0($t0)\njr $t1\n", name))
+}
+
+// Names declared as the characters of a string literal rather than a word
+// holding the address of one
+var stringConstants = make(map[string]bool)
+
+// Loads a tempVar or variable into an integer register
+func loadWord(mipsCode *strings.Builder, register string, name string) {
+	switch determineTypeFromVar(name) {
+	case "STRING":
+		// string constants are the characters themselves, everything else holds an address
+		if stringConstants[name] {
+			mipsCode.WriteString(fmt.Sprintf("la %s, %s\n", register, name))
+		} else {
+			mipsCode.WriteString(fmt.Sprintf("lw %s, %s\n", register, name))
+		}
+	case "CHAR":
+		// chars are unsigned, their byte is 0 to 255
+		mipsCode.WriteString(fmt.Sprintf("lbu %s, %s\n", register, name))
+	default:
+		mipsCode.WriteString(fmt.Sprintf("lw %s, %s\n", register, name))
+	}
+}
+
+// Stores an integer register into a tempVar or variable
+func storeWord(mipsCode *strings.Builder, register string, name string) {
+	if determineTypeFromVar(name) == "CHAR" {
+		mipsCode.WriteString(fmt.Sprintf("sb %s, %s\n", register, name))
+	} else {
+		mipsCode.WriteString(fmt.Sprintf("sw %s, %s\n", register, name))
+	}
+}
+
+// Puts the address of an array element in $t0, using $t1. A constant index
+// is added to the array's address by the assembler
+func elementAddress(mipsCode *strings.Builder, array string, index string) {
+	if constant, known := intConstants[index]; known && constant == 0 {
+		mipsCode.WriteString(fmt.Sprintf("la $t0, %s\n", array))
+		return
+	} else if known {
+		mipsCode.WriteString(fmt.Sprintf("la $t0, %s+%d\n", array, constant*4))
+		return
+	}
+	loadWord(mipsCode, "$t0", index)
+	mipsCode.WriteString(fmt.Sprintf("sll $t0, $t0, 2\nla $t1, %s\nadd $t0, $t0, $t1\n", array))
+}
+
+// Loads or stores register at the element address in $t0. Every element
+// takes a word, of which a char only uses the first byte, loaded unsigned
+func accessElement(mipsCode *strings.Builder, access string, register string, array string) {
+	if determineTypeFromVar(array) == "CHAR" {
+		access = map[string]string{"lw": "lbu", "sw": "sb"}[access]
+	}
+	mipsCode.WriteString(fmt.Sprintf("%s %s, 0($t0)\n", access, register))
+}
+
+// Generates a conversion from the type of arg1 to the type of result
+func generateConversion(mipsCode *strings.Builder, instr TacInstruction) {
+	switch determineTypeFromVar(instr.arg1) + " to " + determineTypeFromVar(instr.result) {
+	case "INT to FLOAT":
+		mipsCode.WriteString(fmt.Sprintf("lw $t0, %s\nmtc1 $t0, $f0\ncvt.s.w $f0, $f0\ns.s $f0, %s\n", instr.arg1, instr.result))
+	case "FLOAT to INT":
+		// rounds to the nearest int, halves to even
+		mipsCode.WriteString(fmt.Sprintf("l.s $f0, %s\ncvt.w.s $f0, $f0\nmfc1 $t0, $f0\nsw $t0, %s\n", instr.arg1, instr.result))
+	case "CHAR to INT":
+		mipsCode.WriteString(fmt.Sprintf("lbu $t0, %s\nsw $t0, %s\n", instr.arg1, instr.result))
+	case "CHAR to FLOAT":
+		mipsCode.WriteString(fmt.Sprintf("lbu $t0, %s\nmtc1 $t0, $f0\ncvt.s.w $f0, $f0\ns.s $f0, %s\n", instr.arg1, instr.result))
+	case "INT to STRING":
+		mipsCode.WriteString(fmt.Sprintf("lw $a0, %s\njal itoa\nsw $v0, %s\n", instr.arg1, instr.result))
+	default:
+		// an int to a char keeps its low byte, the rest are copies
+		loadWord(mipsCode, "$t0", instr.arg1)
+		storeWord(mipsCode, "$t0", instr.result)
+	}
+}
+
+// itoa writes the int in $a0 as decimal digits into a new 12 byte buffer,
+// enough for "-2147483648" and its terminator, and returns its text in $v0.
+// The digits are written backwards from the end of the buffer
+const itoaRoutine = `
+itoa:
+move $t0, $a0
+li $v0, 9
+li $a0, 12
+syscall
+addi $t1, $v0, 11
+sb $zero, 0($t1)
+move $t2, $t0
+bgez $t2, itoa_digits
+subu $t2, $zero, $t2
+itoa_digits:
+li $t3, 10
+itoa_loop:
+divu $t2, $t3
+mfhi $t4
+mflo $t2
+addi $t4, $t4, 48
+addi $t1, $t1, -1
+sb $t4, 0($t1)
+bnez $t2, itoa_loop
+bgez $t0, itoa_done
+li $t4, 45
+addi $t1, $t1, -1
+sb $t4, 0($t1)
+itoa_done:
+move $v0, $t1
+jr $ra
+`
+
+// strcmp compares the strings at $a0 and $a1 a byte at a time, and returns
+// in $v0 the difference of the first bytes that differ, or 0 if none do.
+// Below zero the first string orders first, like in C
+const strcmpRoutine = `
+strcmp:
+lbu $t0, 0($a0)
+lbu $t1, 0($a1)
+bne $t0, $t1, strcmp_done
+beqz $t0, strcmp_done
+addi $a0, $a0, 1
+addi $a1, $a1, 1
+j strcmp
+strcmp_done:
+sub $v0, $t0, $t1
+jr $ra
+`
+
+// Generates the instructions for "result = arg1 op arg2"
+func generateBinary(mipsCode *strings.Builder, instr TacInstruction) {
+	if shift, exists := shiftOps[instr.op]; exists {
+		loadWord(mipsCode, "$t0", instr.arg1)
+		if count, known := intConstants[instr.arg2]; known {
+			mipsCode.WriteString(fmt.Sprintf("%s $t2, $t0, %d\n", shift.immediate, count&31))
+		} else {
+			loadWord(mipsCode, "$t1", instr.arg2)
+			mipsCode.WriteString(fmt.Sprintf("%s $t2, $t0, $t1\n", shift.variable))
+		}
+		storeWord(mipsCode, "$t2", instr.result)
+		return
+	}
+
+	// strings compare by their text, not their addresses
+	if determineTypeFromVar(instr.arg1) == "STRING" {
+		loadWord(mipsCode, "$a0", instr.arg1)
+		loadWord(mipsCode, "$a1", instr.arg2)
+		mipsCode.WriteString(fmt.Sprintf("jal strcmp\n%s $t2, $v0, $zero\n", intOps[instr.op]))
+		storeWord(mipsCode, "$t2", instr.result)
+		return
+	}
+
+	if determineTypeFromVar(instr.arg1) != "FLOAT" {
+		loadWord(mipsCode, "$t0", instr.arg1)
+		loadWord(mipsCode, "$t1", instr.arg2)
+		mipsCode.WriteString(fmt.Sprintf("%s $t2, $t0, $t1\n", intOps[instr.op]))
+		storeWord(mipsCode, "$t2", instr.result)
+		return
+	}
+
+	mipsCode.WriteString(fmt.Sprintf("l.s $f0, %s\nl.s $f1, %s\n", instr.arg1, instr.arg2))
+	if floatOp, exists := floatOps[instr.op]; exists {
+		mipsCode.WriteString(fmt.Sprintf("%s $f2, $f0, $f1\ns.s $f2, %s\n", floatOp, instr.result))
+		return
+	}
+
+	// Float comparisons set the condition flag, which is then moved into a bool
+	compare, move := "", "movt"
+	switch instr.op {
+	case "==":
+		compare = "c.eq.s $f0, $f1"
+	case "!=":
+		compare, move = "c.eq.s $f0, $f1", "movf"
+	case "<":
+		compare = "c.lt.s $f0, $f1"
+	case ">":
+		compare = "c.lt.s $f1, $f0"
+	case "<=":
+		compare = "c.le.s $f0, $f1"
+	case ">=":
+		compare = "c.le.s $f1, $f0"
+	}
+	mipsCode.WriteString(fmt.Sprintf("li $t2, 0\nli $t3, 1\n%s\n%s $t2, $t3\nsw $t2, %s\n", compare, move, instr.result))
+}
+
 // Generate MIPS code from parsed TAC instructions
 func generateMIPS(instructions []TacInstruction) string {
 	var mipsCode strings.Builder
@@ -66,26 +502,75 @@ func generateMIPS(instructions []TacInstruction) string {
 	// Start .data section
 	mipsCode.WriteString(".data\n")
 
-	// Store variables in .data section
+	// Store variables in .data section, each one once
+	declared := make(map[string]bool)
+
+	// Struct variables come first, their fields a word each in declaration
+	// order. A struct whose fields were all folded away takes no space
+	used := make(map[string]bool)
+	for _, instr := range instructions {
+		used[instr.arg1], used[instr.arg2], used[instr.result] = true, true, true
+	}
+	for _, instr := range instructions {
+		if instr.op != "struct" || declared[instr.result] || !slices.ContainsFunc(instr.fields, func(field string) bool { return used[field] }) {
+			continue
+		}
+		declared[instr.result] = true
+
+		mipsCode.WriteString(fmt.Sprintf(".align 2\n%s:\n", instr.result))
+		for _, field := range instr.fields {
+			declared[field] = true
+			mipsCode.WriteString(".align 2\n")
+			declareData(&mipsCode, field, "")
+		}
+	}
+
+	// Arrays take a word per element. One declared in more than one place
+	// gets the largest size it is declared with
+	arraySizes := make(map[string]int)
 	for _, instr := range instructions {
-		// Use the extracted type to determine how to store the variable
-		argType := determineTypeFromVar(instr.result)
-
-		switch argType {
-		case "STRING":
-			mipsCode.WriteString(fmt.Sprintf("%s: .asciiz %s\n", instr.result, instr.arg1))
-		case "CHAR":
-			mipsCode.WriteString(fmt.Sprintf("%s: .byte %s\n", instr.result, instr.arg1))
-		case "BOOL":
-			boolVal := 0
-			if instr.arg1 == "True" {
-				boolVal = 1
+		if instr.op == "array" {
+			arraySizes[instr.result] = max(arraySizes[instr.result], instr.size)
+		}
+	}
+	for _, instr := range instructions {
+		if instr.op != "array" || declared[instr.result] {
+			continue
+		}
+		declared[instr.result] = true
+		mipsCode.WriteString(fmt.Sprintf(".align 2\n%s: .space %d\n", instr.result, 4*arraySizes[instr.result]))
+	}
+
+	for _, instr := range instructions {
+		if instr.result == "" || !isTacName(instr.result) || declared[instr.result] {
+			continue
+		}
+		declared[instr.result] = true
+
+		value := ""
+		if instr.op == "=" && !isTacName(instr.arg1) {
+			value = instr.arg1
+			if constant, err := strconv.Atoi(value); err == nil && strings.HasPrefix(instr.result, "opt_t") && determineTypeFromVar(instr.result) == "INT" {
+				intConstants[instr.result] = constant
+			}
+		}
+		declareData(&mipsCode, instr.result, value)
+	}
+
+	// Jump tables for dense switches
+	for index, instr := range instructions {
+		if instr.op == "switch" && isDenseSwitch(instr) {
+			declareJumpTable(&mipsCode, fmt.Sprintf("switch_table_%d", index), instr)
+		}
+	}
+
+	// Variables that are read but never assigned still need space
+	for _, instr := range instructions {
+		for _, arg := range []string{instr.arg1, instr.arg2} {
+			if isTacName(arg) && !declared[arg] {
+				declared[arg] = true
+				declareData(&mipsCode, arg, "")
 			}
-			mipsCode.WriteString(fmt.Sprintf("%s: .word %d\n", instr.result, boolVal))
-		case "FLOAT":
-			mipsCode.WriteString(fmt.Sprintf("%s: .float %s\n", instr.result, instr.arg1))
-		case "INT":
-			mipsCode.WriteString(fmt.Sprintf("%s: .word %s\n", instr.result, instr.arg1))
 		}
 	}
 
@@ -93,17 +578,78 @@ func generateMIPS(instructions []TacInstruction) string {
 	mipsCode.WriteString("\n.text\n")
 	mipsCode.WriteString("main:\n")
 
-	// Handle syscalls (call write)
-	for _, instr := range instructions {
-		if instr.op == "call" && instr.arg1 == "write" {
+	for index, instr := range instructions {
+		switch instr.op {
+		case "switch":
+			generateSwitch(&mipsCode, fmt.Sprintf("switch_table_%d", index), instr)
+		case "=":
+			// Constants are already initialized in the .data section
+			if !isTacName(instr.arg1) {
+				continue
+			}
+			if determineTypeFromVar(instr.result) == "FLOAT" {
+				mipsCode.WriteString(fmt.Sprintf("l.s $f0, %s\ns.s $f0, %s\n", instr.arg1, instr.result))
+			} else {
+				loadWord(&mipsCode, "$t0", instr.arg1)
+				storeWord(&mipsCode, "$t0", instr.result)
+			}
+		case "neg":
+			if determineTypeFromVar(instr.result) == "FLOAT" {
+				mipsCode.WriteString(fmt.Sprintf("l.s $f0, %s\nneg.s $f2, $f0\ns.s $f2, %s\n", instr.arg1, instr.result))
+			} else {
+				loadWord(&mipsCode, "$t0", instr.arg1)
+				mipsCode.WriteString("sub $t2, $zero, $t0\n")
+				storeWord(&mipsCode, "$t2", instr.result)
+			}
+		case "not":
+			loadWord(&mipsCode, "$t0", instr.arg1)
+			mipsCode.WriteString("seq $t2, $t0, $zero\n")
+			storeWord(&mipsCode, "$t2", instr.result)
+		case "convert":
+			generateConversion(&mipsCode, instr)
+		case "bitnot":
+			loadWord(&mipsCode, "$t0", instr.arg1)
+			mipsCode.WriteString("nor $t2, $t0, $zero\n")
+			storeWord(&mipsCode, "$t2", instr.result)
+		case "struct":
+			// only lays the struct out in the .data section
+		case "array":
+			// zero every word, as the array may be declared again in a loop
+			mipsCode.WriteString(fmt.Sprintf("la $t0, %s\nli $t1, %d\narray_clear_%d:\nsw $zero, 0($t0)\naddi $t0, $t0, 4\naddi $t1, $t1, -1\nbgtz $t1, array_clear_%d\n", instr.result, instr.size, index, index))
+		case "load":
+			elementAddress(&mipsCode, instr.arg1, instr.arg2)
+			accessElement(&mipsCode, "lw", "$t2", instr.arg1)
+			storeWord(&mipsCode, "$t2", instr.result)
+		case "store":
+			elementAddress(&mipsCode, instr.result, instr.arg2)
+			loadWord(&mipsCode, "$t2", instr.arg1)
+			accessElement(&mipsCode, "sw", "$t2", instr.result)
+		case "label":
+			mipsCode.WriteString(fmt.Sprintf("%s:\n", instr.result))
+		case "goto":
+			mipsCode.WriteString(fmt.Sprintf("j %s\n", instr.result))
+		case "if":
+			loadWord(&mipsCode, "$t0", instr.arg1)
+			mipsCode.WriteString(fmt.Sprintf("bnez $t0, %s\n", instr.result))
+		case "ifFalse":
+			loadWord(&mipsCode, "$t0", instr.arg1)
+			mipsCode.WriteString(fmt.Sprintf("beqz $t0, %s\n", instr.result))
+		case "call":
+			// Handle syscalls (call write)
+			if instr.arg1 != "write" {
+				continue
+			}
+
 			// Determine the type of the argument to decide the correct syscall
 			argType := determineTypeFromVar(instr.arg2)
 
 			switch argType {
 			case "STRING":
-				mipsCode.WriteString(fmt.Sprintf("li $v0, 4\nla $a0, %s\nsyscall\n", instr.arg2))
+				mipsCode.WriteString("li $v0, 4\n")
+				loadWord(&mipsCode, "$a0", instr.arg2)
+				mipsCode.WriteString("syscall\n")
 			case "CHAR":
-				mipsCode.WriteString(fmt.Sprintf("li $v0, 11\nlb $a0, %s\nsyscall\n", instr.arg2))
+				mipsCode.WriteString(fmt.Sprintf("li $v0, 11\nlbu $a0, %s\nsyscall\n", instr.arg2))
 			case "BOOL", "INT":
 				mipsCode.WriteString(fmt.Sprintf("li $v0, 1\nlw $a0, %s\nsyscall\n", instr.arg2))
 			case "FLOAT":
@@ -112,12 +658,27 @@ func generateMIPS(instructions []TacInstruction) string {
 				// Default to integer if the type is unknown
 				mipsCode.WriteString(fmt.Sprintf("li $v0, 1\nlw $a0, %s\nsyscall\n", instr.arg2))
 			}
+		default:
+			generateBinary(&mipsCode, instr)
 		}
 	}
 
 	// Add program termination
 	mipsCode.WriteString("\nli $v0, 10\nsyscall\n") // Exit program
 
+	// Runtime routines, after the exit so they only run when called
+	if slices.ContainsFunc(instructions, func(instr TacInstruction) bool {
+		return instr.op == "convert" && determineTypeFromVar(instr.result) == "STRING"
+	}) {
+		mipsCode.WriteString(itoaRoutine)
+	}
+	if slices.ContainsFunc(instructions, func(instr TacInstruction) bool {
+		_, isOperator := intOps[instr.op]
+		return isOperator && determineTypeFromVar(instr.arg1) == "STRING"
+	}) {
+		mipsCode.WriteString(strcmpRoutine)
+	}
+
 	// End of program
 	mipsCode.WriteString("\n# End of program\n")
 
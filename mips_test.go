@@ -0,0 +1,525 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The addresses the simulator lays the program out at, like MARS and SPIM
+const (
+	textBase = 0x00400000
+	dataBase = 0x10010000
+)
+
+// machine runs the MIPS the compiler generates, as much of it as the
+// compiler uses, and collects what the syscalls write
+type machine struct {
+	t        *testing.T
+	text     [][]string
+	labels   map[string]uint32
+	memory   []byte
+	heap     uint32
+	regs     map[string]int32
+	fregs    map[string]uint32
+	flag     bool
+	hi, lo   int32
+	output   strings.Builder
+	finished bool
+}
+
+// simulate runs the generated MIPS and returns what it writes
+func simulate(t *testing.T, code string) string {
+	t.Helper()
+
+	m := &machine{
+		t:      t,
+		labels: make(map[string]uint32),
+		regs:   make(map[string]int32),
+		fregs:  make(map[string]uint32),
+	}
+	m.load(code)
+
+	pc := uint32(textBase)
+	if main, exists := m.labels["main"]; exists {
+		pc = main
+	}
+	for steps := 0; !m.finished; steps++ {
+		if steps > 10_000_000 {
+			t.Fatalf("program is still running after %d instructions, wrote %q", steps, m.output.String())
+		}
+		index := (pc - textBase) / 4
+		if int(index) >= len(m.text) {
+			break
+		}
+		pc = m.step(m.text[index], pc+4)
+	}
+	return m.output.String()
+}
+
+// load lays out the .data section and collects the instructions and labels
+// of the .text section. Words naming a label are filled in once every
+// label is known
+func (m *machine) load(code string) {
+	type fixup struct {
+		offset int
+		label  string
+	}
+	var fixups []fixup
+
+	inText := false
+	for _, line := range strings.Split(code, "\n") {
+		if comment := strings.Index(line, "#"); comment != -1 && !strings.Contains(line, "\"") {
+			line = line[:comment]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case line == ".data":
+			inText = false
+			continue
+		case line == ".text":
+			inText = true
+			continue
+		}
+
+		if inText {
+			if label, isLabel := strings.CutSuffix(line, ":"); isLabel {
+				m.labels[label] = textBase + uint32(4*len(m.text))
+				continue
+			}
+			op, operands, _ := strings.Cut(line, " ")
+			instr := []string{op}
+			for _, operand := range strings.Split(operands, ",") {
+				if operand = strings.TrimSpace(operand); operand != "" {
+					instr = append(instr, operand)
+				}
+			}
+			m.text = append(m.text, instr)
+			continue
+		}
+
+		label, directive, hasLabel := strings.Cut(line, ":")
+		if !hasLabel || strings.HasPrefix(line, ".") {
+			label, directive = "", line
+		}
+		directive = strings.TrimSpace(directive)
+		kind, args, _ := strings.Cut(directive, " ")
+		args = strings.TrimSpace(args)
+
+		if kind == ".word" || kind == ".float" || kind == ".align" {
+			for len(m.memory)%4 != 0 {
+				m.memory = append(m.memory, 0)
+			}
+		}
+		if label != "" {
+			m.labels[label] = dataBase + uint32(len(m.memory))
+		}
+
+		switch kind {
+		case "", ".align":
+		case ".word":
+			for _, word := range strings.Split(args, ",") {
+				word = strings.TrimSpace(word)
+				value, err := strconv.ParseInt(word, 0, 64)
+				if err != nil {
+					fixups = append(fixups, fixup{len(m.memory), word})
+				}
+				m.memory = binary.LittleEndian.AppendUint32(m.memory, uint32(value))
+			}
+		case ".byte":
+			for _, value := range strings.Split(args, ",") {
+				value = strings.TrimSpace(value)
+				if strings.HasPrefix(value, "'") {
+					m.memory = append(m.memory, value[1])
+					continue
+				}
+				number, err := strconv.ParseInt(value, 0, 64)
+				if err != nil {
+					m.t.Fatalf("bad .byte %q", line)
+				}
+				m.memory = append(m.memory, byte(number))
+			}
+		case ".float":
+			value, err := strconv.ParseFloat(args, 32)
+			if err != nil {
+				m.t.Fatalf("bad .float %q", line)
+			}
+			m.memory = binary.LittleEndian.AppendUint32(m.memory, math.Float32bits(float32(value)))
+		case ".asciiz":
+			text, err := strconv.Unquote(args)
+			if err != nil {
+				m.t.Fatalf("bad .asciiz %q", line)
+			}
+			m.memory = append(append(m.memory, text...), 0)
+		case ".space":
+			size, _ := strconv.Atoi(args)
+			m.memory = append(m.memory, make([]byte, size)...)
+		default:
+			m.t.Fatalf("unknown directive %q", line)
+		}
+	}
+
+	for _, fix := range fixups {
+		address, exists := m.labels[fix.label]
+		if !exists {
+			m.t.Fatalf("undefined label %q", fix.label)
+		}
+		binary.LittleEndian.PutUint32(m.memory[fix.offset:], address)
+	}
+
+	m.heap = dataBase + uint32(len(m.memory)+7)&^7
+}
+
+// step runs one instruction and returns the address of the next
+func (m *machine) step(instr []string, next uint32) uint32 {
+	reg := func(i int) int32 { return m.reg(instr[i]) }
+	set := func(value int32) { m.setReg(instr[1], value) }
+	float := func(i int) float32 { return math.Float32frombits(m.fregs[instr[i]]) }
+	setFloat := func(value float32) { m.fregs[instr[1]] = math.Float32bits(value) }
+	// the last operand of an arithmetic instruction, a register or an immediate
+	operand := func(i int) int32 {
+		if strings.HasPrefix(instr[i], "$") {
+			return reg(i)
+		}
+		return m.immediate(instr[i])
+	}
+	boolean := func(holds bool) int32 {
+		if holds {
+			return 1
+		}
+		return 0
+	}
+
+	switch instr[0] {
+	case "li":
+		set(m.immediate(instr[2]))
+	case "la":
+		set(int32(m.address(instr[2])))
+	case "move":
+		set(reg(2))
+	case "lw":
+		set(int32(binary.LittleEndian.Uint32(m.at(m.address(instr[2]), 4))))
+	case "lb":
+		set(int32(int8(m.at(m.address(instr[2]), 1)[0])))
+	case "lbu":
+		set(int32(m.at(m.address(instr[2]), 1)[0]))
+	case "sw":
+		binary.LittleEndian.PutUint32(m.at(m.address(instr[2]), 4), uint32(reg(1)))
+	case "sb":
+		m.at(m.address(instr[2]), 1)[0] = byte(reg(1))
+	case "l.s":
+		m.fregs[instr[1]] = binary.LittleEndian.Uint32(m.at(m.address(instr[2]), 4))
+	case "s.s":
+		binary.LittleEndian.PutUint32(m.at(m.address(instr[2]), 4), m.fregs[instr[1]])
+	case "add", "addu", "addi", "addiu":
+		set(reg(2) + operand(3))
+	case "sub", "subu":
+		set(reg(2) - operand(3))
+	case "mul":
+		set(reg(2) * operand(3))
+	case "div":
+		if len(instr) == 3 {
+			m.hi, m.lo = reg(1)%reg(2), reg(1)/reg(2)
+			break
+		}
+		set(reg(2) / operand(3))
+	case "divu":
+		m.hi, m.lo = int32(uint32(reg(1))%uint32(reg(2))), int32(uint32(reg(1))/uint32(reg(2)))
+	case "rem":
+		set(reg(2) % operand(3))
+	case "mfhi":
+		set(m.hi)
+	case "mflo":
+		set(m.lo)
+	case "and", "andi":
+		set(reg(2) & operand(3))
+	case "or", "ori":
+		set(reg(2) | operand(3))
+	case "xor", "xori":
+		set(reg(2) ^ operand(3))
+	case "nor":
+		set(^(reg(2) | operand(3)))
+	case "sll", "sllv":
+		set(reg(2) << (operand(3) & 31))
+	case "sra", "srav":
+		set(reg(2) >> (operand(3) & 31))
+	case "srl", "srlv":
+		set(int32(uint32(reg(2)) >> (operand(3) & 31)))
+	case "seq":
+		set(boolean(reg(2) == operand(3)))
+	case "sne":
+		set(boolean(reg(2) != operand(3)))
+	case "slt", "slti":
+		set(boolean(reg(2) < operand(3)))
+	case "sltu", "sltiu":
+		set(boolean(uint32(reg(2)) < uint32(operand(3))))
+	case "sgt":
+		set(boolean(reg(2) > operand(3)))
+	case "sge":
+		set(boolean(reg(2) >= operand(3)))
+	case "sle":
+		set(boolean(reg(2) <= operand(3)))
+	case "j":
+		return m.label(instr[1])
+	case "jal":
+		m.regs["$ra"] = int32(next)
+		return m.label(instr[1])
+	case "jr":
+		return uint32(reg(1))
+	case "beq":
+		if reg(1) == operand(2) {
+			return m.label(instr[3])
+		}
+	case "bne":
+		if reg(1) != operand(2) {
+			return m.label(instr[3])
+		}
+	case "beqz", "bnez", "bgez", "bgtz", "bltz", "blez":
+		value := reg(1)
+		taken := map[string]bool{
+			"beqz": value == 0, "bnez": value != 0,
+			"bgez": value >= 0, "bgtz": value > 0,
+			"bltz": value < 0, "blez": value <= 0,
+		}[instr[0]]
+		if taken {
+			return m.label(instr[2])
+		}
+	case "mtc1":
+		m.fregs[instr[2]] = uint32(reg(1))
+	case "mfc1":
+		set(int32(m.fregs[instr[2]]))
+	case "cvt.s.w":
+		setFloat(float32(int32(m.fregs[instr[2]])))
+	case "cvt.w.s":
+		m.fregs[instr[1]] = uint32(int32(math.RoundToEven(float64(float(2)))))
+	case "add.s":
+		setFloat(float(2) + float(3))
+	case "sub.s":
+		setFloat(float(2) - float(3))
+	case "mul.s":
+		setFloat(float(2) * float(3))
+	case "div.s":
+		setFloat(float(2) / float(3))
+	case "neg.s":
+		setFloat(-float(2))
+	case "c.eq.s":
+		m.flag = float(1) == float(2)
+	case "c.lt.s":
+		m.flag = float(1) < float(2)
+	case "c.le.s":
+		m.flag = float(1) <= float(2)
+	case "movt", "movf":
+		if m.flag == (instr[0] == "movt") {
+			set(reg(2))
+		}
+	case "syscall":
+		m.syscall()
+	default:
+		m.t.Fatalf("unknown instruction %q", strings.Join(instr, " "))
+	}
+	return next
+}
+
+// syscall runs the MARS syscall numbered by $v0
+func (m *machine) syscall() {
+	switch m.regs["$v0"] {
+	case 1:
+		m.output.WriteString(strconv.Itoa(int(m.regs["$a0"])))
+	case 2:
+		text := strconv.FormatFloat(float64(math.Float32frombits(m.fregs["$f12"])), 'f', -1, 32)
+		if !strings.Contains(text, ".") {
+			text += ".0"
+		}
+		m.output.WriteString(text)
+	case 4:
+		for address := uint32(m.regs["$a0"]); m.at(address, 1)[0] != 0; address++ {
+			m.output.WriteByte(m.at(address, 1)[0])
+		}
+	case 9:
+		m.regs["$v0"] = int32(m.heap)
+		m.heap += (uint32(m.regs["$a0"]) + 7) &^ 7
+	case 10:
+		m.finished = true
+	case 11:
+		m.output.WriteByte(byte(m.regs["$a0"]))
+	default:
+		m.t.Fatalf("unknown syscall %d", m.regs["$v0"])
+	}
+}
+
+func (m *machine) reg(name string) int32 {
+	if name == "$zero" || name == "$0" {
+		return 0
+	}
+	return m.regs[name]
+}
+
+func (m *machine) setReg(name string, value int32) {
+	if name != "$zero" && name != "$0" {
+		m.regs[name] = value
+	}
+}
+
+func (m *machine) immediate(text string) int32 {
+	value, err := strconv.ParseInt(text, 0, 64)
+	if err != nil {
+		m.t.Fatalf("bad immediate %q", text)
+	}
+	return int32(value)
+}
+
+func (m *machine) label(name string) uint32 {
+	address, exists := m.labels[name]
+	if !exists {
+		m.t.Fatalf("undefined label %q", name)
+	}
+	return address
+}
+
+// address resolves "label", "label+8" or "4($t0)"
+func (m *machine) address(operand string) uint32 {
+	if offset, register, indirect := strings.Cut(operand, "("); indirect {
+		base := uint32(m.reg(strings.TrimSuffix(register, ")")))
+		if offset == "" {
+			return base
+		}
+		return base + uint32(m.immediate(offset))
+	}
+	if label, offset, hasOffset := strings.Cut(operand, "+"); hasOffset {
+		return m.label(label) + uint32(m.immediate(offset))
+	}
+	return m.label(operand)
+}
+
+// at is the memory from address on, grown as the heap is used
+func (m *machine) at(address uint32, size int) []byte {
+	if address < dataBase {
+		m.t.Fatalf("access outside of memory at %#x", address)
+	}
+	offset := int(address - dataBase)
+	if offset+size > len(m.memory) {
+		if offset+size > 64<<20 {
+			m.t.Fatalf("access outside of memory at %#x", address)
+		}
+		m.memory = append(m.memory, make([]byte, offset+size-len(m.memory))...)
+	}
+	return m.memory[offset : offset+size]
+}
+
+func TestSimulator(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"int", "write(1 + 2)\n", "3"},
+		{"string", "write(\"hi\\n\")\n", "hi\n"},
+		{"runtime loop", runtimeValue + "write(n)\n", "2000"},
+	})
+}
+
+func TestRuntimeStringComparison(t *testing.T) {
+	const s = runtimeValue + "string s = string(n)\n"
+	checkOutput(t, []outputCase{
+		{"equal", s + "write(s == \"2000\")\n", "1"},
+		{"not equal", s + "write(s != \"2000\")\n", "0"},
+		{"different", s + "write(s == \"2001\")\n", "0"},
+		{"less", s + "write(s < \"3\")\n", "1"},
+		{"greater", s + "write(s > \"1999\")\n", "1"},
+		{"prefix", s + "write(s < \"20000\")\n", "1"},
+		{"both runtime", s + "string t = string(n + 1)\nwrite(s < t)\nwrite(t <= s)\n", "10"},
+		{"folded like runtime", "write(\"2000\" < \"3\")\nwrite(\"a!\" < \"a\")\n", "10"},
+	})
+}
+
+func TestCharsAreUnsigned(t *testing.T) {
+	const c = runtimeValue + "char c = char(n - 1745)\n"
+	checkOutput(t, []outputCase{
+		{"switch", c + "switch (c) {\ncase '\\xff':\n    write(\"ff\")\ndefault:\n    write(\"other\")\n}\n", "ff"},
+		{"sparse switch", c + "switch (c) {\ncase 'a':\n    write(\"a\")\ncase '\\xff':\n    write(\"ff\")\n}\n", "ff"},
+		{"folded switch", "switch ('\\xff') {\ncase '\\xff':\n    write(\"ff\")\ndefault:\n    write(\"other\")\n}\n", "ff"},
+		{"compare", c + "write(c > 'a')\n", "1"},
+		{"folded compare", "write('\\xff' > 'a')\n", "1"},
+		{"to int", c + "write(int(c))\n", "255"},
+		{"folded to int", "write(int('\\xff'))\n", "255"},
+		{"to float", c + "write(float(c))\n", "255.0"},
+		{"array element", c + "[2]char chars\nchars[n - 2000] = c\nwrite(int(chars[n - 2000]))\n", "255"},
+	})
+}
+
+func TestSwitch(t *testing.T) {
+	const cases = "case 1:\n    write(\"one\")\ncase 2, 3:\n    write(\"two or three\")\ncase 4:\n    write(\"four\")\ndefault:\n    write(\"other\")\n}\n"
+	const sparse = "case 1:\n    write(\"one\")\ncase 100:\n    write(\"hundred\")\ncase 1000, 2000:\n    write(\"thousands\")\n}\nwrite(\".\")\n"
+	checkOutput(t, []outputCase{
+		{"folded", "switch (3) {\n" + cases, "two or three"},
+		{"folded default", "switch (9) {\n" + cases, "other"},
+		{"dense", runtimeValue + "switch (n - 1997) {\n" + cases, "two or three"},
+		{"dense first", runtimeValue + "switch (n - 1999) {\n" + cases, "one"},
+		{"dense below", runtimeValue + "switch (n - 2000) {\n" + cases, "other"},
+		{"dense above", runtimeValue + "switch (n) {\n" + cases, "other"},
+		{"sparse", runtimeValue + "switch (n) {\n" + sparse, "thousands."},
+		{"sparse no match", runtimeValue + "switch (n + 1) {\n" + sparse, "."},
+		{"break leaves the loop", runtimeValue + "int i = 0\nwhile (i < n) {\n    i++\n    switch (i) {\n    case 3:\n        break\n    }\n}\nwrite(i)\n", "3"},
+	})
+
+	tests := []struct {
+		name   string
+		source string
+		table  bool
+	}{
+		{"dense", runtimeValue + "switch (n) {\n" + cases, true},
+		{"sparse", runtimeValue + "switch (n) {\n" + sparse, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name+" lowering", func(t *testing.T) {
+			result := compile(t, test.source)
+			if table := strings.Contains(result.mips, "switch_table_"); table != test.table {
+				t.Errorf("jump table: %v, want %v:\n%s", table, test.table, result.mips)
+			}
+		})
+	}
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"string", "switch (\"a\") {\ncase \"a\":\n    write(1)\n}\n", "Can only switch on int, char or an enum, got STRING"},
+		{"duplicate", "int v = 2\nswitch (v) {\ncase 1:\n    write(1)\ncase 2, 1:\n    write(2)\n}\n", "Duplicate case value 1"},
+		{"not constant", "int v = 2\nswitch (v) {\ncase v:\n    write(1)\n}\n", "Case value must be an int, char or enum constant"},
+		{"type mismatch", "int v = 2\nswitch (v) {\ncase 'a':\n    write(1)\n}\n", "Case value 'a' (CHAR) does not match switch value (INT)"},
+		{"two defaults", "int v = 2\nswitch (v) {\ndefault:\n    write(1)\ndefault:\n    write(2)\n}\n", "Switch already has a default"},
+		{"statement outside a case", "int v = 2\nswitch (v) {\n    write(1)\n}\n", "Expected case or default in switch, got write"},
+	})
+}
+
+func TestArrays(t *testing.T) {
+	const grid = "[3][3]int m = {{1, 2, 3}, {4, 5, 6}}\n"
+	checkOutput(t, []outputCase{
+		{"sized", "[5]int a\nfor (int i = 0; i < len(a); i++) {\n    a[i] = i * i\n}\nwrite(a[3])\n", "9"},
+		{"multi-dimensional", grid + "write(m[1][2])\nwrite(m[2][0])\nwrite(len(m[0]))\n", "603"},
+		{"length from literal", "[]char cs = {'h', 'i'}\nwrite(cs[0])\nwrite(cs[1])\nwrite(len(cs))\n", "hi2"},
+		{"runtime index", runtimeValue + "[5]int a\nint j = n % 3\na[j] = 42\nwrite(a[j])\nwrite(a[0])\nwrite(a[1])\n", "4200"},
+		{"runtime row", runtimeValue + grid + "m[n % 3 - 1][1] += 10\nwrite(m[1][1])\nwrite(m[0][1])\n", "152"},
+		{"floats", runtimeValue + "[2]float fs = {1.5}\nfs[n % 2 + 1] = 2.5\nwrite(fs[0])\nwrite(fs[1])\n", "1.52.5"},
+		{"strings", runtimeValue + "[2]string names = {\"ab\", \"cd\"}\nwrite(names[n % 2 + 1])\n", "cd"},
+		{"copy", "[3]int a = {1, 2, 3}\n[3]int b = a\nb[1] = 7\nwrite(b[1] + a[1])\n", "9"},
+		{"row copy", grid + "m[2] = m[1]\nwrite(m[2][2])\n", "6"},
+		{"global in a function", "global [2]int g\nfunc bump(int k) int {\n    g[k] = g[k] + 1\n    return g[k]\n}\nwrite(bump(1))\nwrite(bump(1))\nwrite(g[0])\n", "120"},
+		{"assigned at runtime", runtimeValue + "[3]int a = {1, 2, 3}\nif (n > 5) {\n    a[0] = 9\n}\nwrite(a[0])\nwrite(a[1])\n", "92"},
+		{"zeroed every iteration", runtimeValue + "int s = 0\nfor (int k = 0; k < n; k++) {\n    [2]int pair\n    pair[k % 2] = k\n    s = s + pair[0]\n}\nwrite(s)\n", "999000"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"index past the end", "[3]int a\na[3] = 1\n", "Index 3 is out of range for a (length 3)"},
+		{"negative index", "[3]int a\nint x = a[-1]\n", "Index -1 is out of range for a (length 3)"},
+		{"unrolled index", "[3]int a\nfor (int i = 0; i < 5; i++) {\n    a[i] = i\n}\n", "Index 3 is out of range for a (length 3)"},
+		{"zero length", "[0]int z\n", "Array length must be positive, got 0"},
+		{"literal too long", "[2]int b = {1, 2, 3}\n", "Array literal has 3 elements, more than the 2 of [2]INT"},
+		{"element type", "[2]int c = {1, \"s\"}\n", "Array element \"s\" (STRING) does not match element type INT"},
+		{"assigned a scalar", "[3]int a\na = 5\n", "Type mismatch between a ([3]INT) and 5 (INT)"},
+		{"arithmetic", "[3]int a\nint y = a + 1\n", "Cannot apply \"+\" to an array, only to its elements"},
+		{"write", "[3]int a\nwrite(a)\n", "Cannot write a whole array, write its elements instead"},
+		{"len of a scalar", "int x = 1\nx = len(x)\n", "Cannot take len of x (INT), only of an array"},
+		{"too many indexes", "[2][2]int m\nm[0][0][0] = 1\n", "Too many indexes for m ([2][2]INT)"},
+		{"row to a scalar", "[2][2]int m\nint q = m[0]\n", "Type mismatch between q (INT) and m ([2]INT)"},
+		{"no length", "[]int e\n", "Array e is declared with \"[]\", it needs a literal to take the length from"},
+		{"bool index", "[3]int a\nbool f = a[True]\n", "Array index must be an INT, got BOOL"},
+	})
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
-	"os"
-	"regexp"
+	"math"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 type ValueTable struct {
@@ -23,14 +25,24 @@ func optimizer(root *Node) Node {
 	}
 
 	for index, statement := range root.Body {
+		// what functions inlined in this statement run goes before it
+		statementStart := len(optimizedAST.Body)
+
 		switch statement.Type {
 		case "ASSIGN":
+			if isStructType(statement.Left.DType) || isArrayType(statement.Left.DType) {
+				optimizedAST.Body = append(optimizedAST.Body, fold(root, statement, index).Body...)
+				break
+			}
+			if statement.Left.Type == "ARRAY_INDEX" {
+				optimizedAST.Body = append(optimizedAST.Body, fold(root, statement, index))
+				break
+			}
+
 			optimizedNode := fold(root, statement.Right, index)
 			statement.Right = optimizedNode
 			if optimizedNode != nil {
-				if optimizedNode.Value != "{}" {
-					optimizedAST.Body = append(optimizedAST.Body, statement)
-				}
+				optimizedAST.Body = append(optimizedAST.Body, statement)
 			}
 			updateValueTable(&Values, statement)
 		case "FUNCTION_CALL":
@@ -39,77 +51,67 @@ func optimizer(root *Node) Node {
 				for paramIndex, param := range writeNode.Params {
 					writeNode.Params[paramIndex] = fold(root, param, index)
 				}
-				optimizedAST.Body = append(optimizedAST.Body, writeNode)
+				optimizedAST.Body = append(optimizedAST.Body, writeEnum(writeNode))
 			} else {
-				funcNode := getFunction(&Functions, statement.Value)
-				params := statement.Params
-
-				if len(funcNode.Params) != len(params) {
-					fmt.Println("Optimizer: more parameters than accepted!")
-					os.Exit(3)
-				}
-
-				var foldedParams []*Node
-				for paramIndex, param := range params {
-					paramNode := Node{
-						DType: "OP",
-						Type:  "ASSIGN",
-						Value: "=",
-						Right: fold(root, param, index),
-						Left:  funcNode.Params[paramIndex],
-					}
-					foldedParams = append(foldedParams, &paramNode)
-				}
-
-				foldedFunction := foldFunction(funcNode, foldedParams, index)
-				if foldedFunction != nil && foldedFunction.Type == "ASSIGN" {
-					optimizedAST.Body = append(optimizedAST.Body, foldedFunction.Right)
-				} else if funcNode != nil {
-					optimizedAST.Body = append(optimizedAST.Body, foldedFunction.Body...)
-				}
+				// a call on its own line only runs for what it does
+				body, _ := inlineCall(root, statement, index)
+				optimizedAST.Body = append(optimizedAST.Body, body...)
 			}
 		case "IF_STATEMENT":
 			optimizedIfNode := optimizeIfStatement(root, statement, index)
+			// a false condition without an else runs nothing
 			if optimizedIfNode == nil {
-				fmt.Println("Warning: optimizeIfStatement returned nil")
 				continue
 			}
 
-			// Add a nil check for Left before accessing its Value
-			if optimizedIfNode.Left == nil {
-				fmt.Println("Warning: optimizedIfNode.Left is nil")
+			if !isResidual(optimizedIfNode.Left) {
+				optimizedAST.Body = append(optimizedAST.Body, optimizedIfNode.Body...)
+			} else {
 				optimizedAST.Body = append(optimizedAST.Body, optimizedIfNode)
+			}
+
+		case "SWITCH_STATEMENT":
+			optimizedSwitch := optimizeSwitch(root, statement, index)
+			if optimizedSwitch == nil {
 				continue
 			}
 
-			if optimizedIfNode.Left.Value == "FALSE" || optimizedIfNode.Left.Value == "TRUE" {
-				for _, nice := range optimizedIfNode.Body {
-					optimizedStatement := fold(root, nice, index)
-					if optimizedStatement != nil {
-						optimizedAST.Body = append(optimizedAST.Body, optimizedStatement)
-					}
-				}
+			if optimizedSwitch.Type == "IF_STATEMENT" {
+				optimizedAST.Body = append(optimizedAST.Body, optimizedSwitch.Body...)
 			} else {
-				optimizedAST.Body = append(optimizedAST.Body, optimizedIfNode)
+				optimizedAST.Body = append(optimizedAST.Body, optimizedSwitch)
 			}
 
 		case "FOR_LOOP":
-			unrolledForLoop := optimizeForLoop(root, statement, index)
-			var optimizedForLoop Node
-			for _, stmt := range unrolledForLoop.Body {
-				optimizedStmt := fold(root, stmt, index)
-				if optimizedStmt != nil {
-					if optimizedStmt.Value == "IF_STATEMENT" {
-						optimizedForLoop.Body = append(optimizedForLoop.Body, optimizedStmt.Body...)
-					}
-					optimizedForLoop.Body = append(optimizedForLoop.Body, optimizedStmt)
-				}
+			optimizedForLoop := optimizeForLoop(root, statement, index)
+			if optimizedForLoop.Type == "FOR_LOOP" {
+				optimizedAST.Body = append(optimizedAST.Body, optimizedForLoop)
+			} else {
+				optimizedAST.Body = append(optimizedAST.Body, optimizedForLoop.Body...)
+			}
+
+		case "WHILE_LOOP", "DO_WHILE_LOOP":
+			optimizedWhileLoop := optimizeWhileLoop(root, statement, index)
+			if optimizedWhileLoop.Type == statement.Type {
+				optimizedAST.Body = append(optimizedAST.Body, optimizedWhileLoop)
+			} else {
+				optimizedAST.Body = append(optimizedAST.Body, optimizedWhileLoop.Body...)
 			}
-			optimizedAST.Body = append(optimizedAST.Body, optimizedForLoop.Body...)
 
 		case "FUNCTION_DECL":
 			addFunction(&Functions, statement)
+
+		case "STRUCT_VAR":
+			optimizedAST.Body = append(optimizedAST.Body, statement)
+
+		case "ARRAY_VAR":
+			optimizedAST.Body = append(optimizedAST.Body, fold(root, statement, index))
+
+		case "CONST_DECL":
+			fold(root, statement, index)
 		}
+
+		optimizedAST.Body = slices.Insert(optimizedAST.Body, statementStart, takeInlinedStatements()...)
 	}
 
 	return optimizedAST
@@ -121,6 +123,7 @@ func optimizeIfStatement(root *Node, ifNode *Node, index int) *Node {
 		Type:  "IF_STATEMENT",
 		Value: "if",
 		Body:  []*Node{},
+		Pos:   ifNode.Pos,
 	}
 
 	// Optimize condition
@@ -133,41 +136,35 @@ func optimizeIfStatement(root *Node, ifNode *Node, index int) *Node {
 
 	}
 
-	condition := newIfNode.Left.Value
+	// literals are "True" and "False", folded conditions "TRUE" and "FALSE"
+	condition := boolNode(newIfNode.Left)
 
 	// Recursive folding for both main body and else body
 	if condition == "FALSE" && ifNode.Right != nil {
 		// Process else branch
-		for _, stmt := range ifNode.Right.Body {
-			optimizedStmt := fold(root, stmt, index)
-			if optimizedStmt != nil {
-				// Recursively handle nested if statements
-				if optimizedStmt.Type == "IF_STATEMENT" {
-					recursiveOptimizedStmt := optimizeIfStatement(root, optimizedStmt, index)
-					newIfNode.Body = append(newIfNode.Body, recursiveOptimizedStmt.Body...)
-				} else {
-					newIfNode.Body = append(newIfNode.Body, optimizedStmt)
-				}
-			}
-		}
+		newIfNode.Body = foldStatements(root, ifNode.Right.Body, index)
 	} else if condition == "TRUE" {
 		// Process main body
-		for _, stmt := range ifNode.Body {
-			optimizedStmt := fold(root, stmt, index) // fold each statement
-			// if the statement isn't nil
-			if optimizedStmt != nil {
-				// if the statement is an if statement:
-				// we want to append the body directly
-				// to the body of the new if statement
-				if optimizedStmt.Type == "IF_STATEMENT" {
-					// append body of if to body of newifnode
-					newIfNode.Body = append(newIfNode.Body, optimizedStmt.Body...)
-				} else {
-					// otherwise just append the node like normal
-					newIfNode.Body = append(newIfNode.Body, optimizedStmt)
-				}
+		newIfNode.Body = foldStatements(root, ifNode.Body, index)
+	} else if isResidual(newIfNode.Left) {
+		// The condition is only known at runtime, so both branches are kept.
+		// Each one is folded from the values known before the if, and
+		// whatever either of them assigns is unknown afterwards
+		snapshot := len(Values.Body)
+		newIfNode.Body = foldStatements(root, ifNode.Body, index)
+		Values.Body = Values.Body[:snapshot]
+
+		if ifNode.Right != nil {
+			newIfNode.Right = &Node{
+				Type:  "ELSE_STATEMENT",
+				Value: "else",
+				Body:  foldStatements(root, ifNode.Right.Body, index),
+				Pos:   ifNode.Right.Pos,
 			}
+			Values.Body = Values.Body[:snapshot]
 		}
+
+		forgetAssigned(newIfNode)
 	} else { // if it is false and node.right is nil (no else)
 		return nil
 	}
@@ -175,13 +172,241 @@ func optimizeIfStatement(root *Node, ifNode *Node, index int) *Node {
 	return newIfNode
 }
 
+// optimizeSwitch runs the case a constant value matches, returned like an if
+// that folded to true, or nil when nothing matches. A switch on a value only
+// known at runtime is kept with every clause folded
+func optimizeSwitch(root *Node, switchNode *Node, index int) *Node {
+	value := fold(root, switchNode.Left, index)
+
+	if value.Type == "INT" || value.Type == "CHAR" {
+		var chosen *Node
+		for _, clause := range switchNode.Body {
+			if clause.Type == "DEFAULT" && chosen == nil {
+				chosen = clause
+			}
+			for _, caseValue := range clause.Params {
+				if caseKey(caseValue) == caseKey(value) {
+					chosen = clause
+				}
+			}
+		}
+
+		if chosen == nil {
+			return nil
+		}
+
+		return &Node{
+			Type:  "IF_STATEMENT",
+			Value: "if",
+			Left:  &Node{Type: "BOOL", DType: "BOOL", Value: "TRUE"},
+			Body:  foldStatements(root, chosen.Body, index),
+			Pos:   switchNode.Pos,
+		}
+	}
+
+	// Like an if decided at runtime, each clause starts from the values known
+	// before the switch and whatever any of them assigns is unknown afterwards
+	newSwitchNode := &Node{
+		Type:  "SWITCH_STATEMENT",
+		Value: "switch",
+		Left:  value,
+		Pos:   switchNode.Pos,
+	}
+
+	snapshot := len(Values.Body)
+	for _, clause := range switchNode.Body {
+		newSwitchNode.Body = append(newSwitchNode.Body, &Node{
+			Type:   clause.Type,
+			Value:  clause.Value,
+			Params: clause.Params,
+			Body:   foldStatements(root, clause.Body, index),
+			Pos:    clause.Pos,
+		})
+		Values.Body = Values.Body[:snapshot]
+	}
+
+	forgetAssigned(newSwitchNode)
+
+	return newSwitchNode
+}
+
+// foldStatements folds a block, splicing in the bodies of ifs whose condition
+// folded to a constant and of inlined function calls
+func foldStatements(root *Node, statements []*Node, index int) []*Node {
+	var folded []*Node
+
+	// statements inlined so far belong to the statement this block is part of
+	outerInlined := takeInlinedStatements()
+	defer func() {
+		inlinedStatements = outerInlined
+	}()
+
+	for _, stmt := range statements {
+		var optimizedStmt *Node
+		if stmt.Type == "FUNCTION_CALL" && stmt.Value != "write" {
+			// a call on its own line only runs for what it does
+			body, _ := inlineCall(root, stmt, index)
+			optimizedStmt = &Node{Type: "BLOCK", Body: body}
+		} else {
+			optimizedStmt = fold(root, stmt, index)
+		}
+		folded = append(folded, takeInlinedStatements()...)
+		if optimizedStmt == nil {
+			continue
+		}
+
+		if (optimizedStmt.Type == "IF_STATEMENT" && !isResidual(optimizedStmt.Left)) || optimizedStmt.Type == "FUNCTION_DECL" || optimizedStmt.Type == "BLOCK" {
+			folded = append(folded, optimizedStmt.Body...)
+		} else {
+			folded = append(folded, optimizedStmt)
+		}
+
+		// nothing after a break, continue or return in the same block is ever run
+		if len(folded) > 0 && (isLoopExit(folded[len(folded)-1]) || folded[len(folded)-1].Type == "RETURN") {
+			break
+		}
+	}
+
+	return folded
+}
+
+// inlinedStatements are the statements of the functions inlined while
+// folding the current statement. They run before it
+var inlinedStatements []*Node
+
+func takeInlinedStatements() []*Node {
+	statements := inlinedStatements
+	inlinedStatements = nil
+	return statements
+}
+
+// foldGuarded folds an operand that only runs on some paths at runtime, the
+// right side of && and || or an arm of ?:. The statements of the calls
+// inlined into it can't run before the whole statement like the rest, so
+// they go in an INLINED node that runs them right before the operand's
+// value, and whatever they assign is unknown afterwards
+func foldGuarded(root *Node, node *Node, index int) *Node {
+	snapshot := len(Values.Body)
+	inlinedMark := len(inlinedStatements)
+
+	value := fold(root, node, index)
+
+	statements := slices.Clone(inlinedStatements[inlinedMark:])
+	inlinedStatements = inlinedStatements[:inlinedMark]
+	Values.Body = Values.Body[:snapshot]
+	if len(statements) == 0 {
+		return value
+	}
+
+	guarded := &Node{
+		Type:  "INLINED",
+		DType: value.DType,
+		Value: value.Value,
+		Left:  value,
+		Body:  statements,
+		Pos:   node.Pos,
+	}
+	forgetAssigned(guarded)
+	return guarded
+}
+
+// maxInlineDepth is how deep calls may nest while being inlined, which is
+// what stops a recursion that doesn't end at compile time
+const maxInlineDepth = 100
+
+var inlineDepth int
+
+// inlineCall folds a call to a declared function into the statements it runs,
+// with the parameters assigned first, and the value it returns if any
+func inlineCall(root *Node, call *Node, index int) (body []*Node, value *Node) {
+	funcNode := getFunction(&Functions, call.Value)
+	if funcNode == nil {
+		errorAt(call.Pos, "Unrecognized function \""+call.Value+"\"")
+	}
+
+	if inlineDepth >= maxInlineDepth {
+		errorAt(call.Pos, fmt.Sprintf("Calls to %s nest more than %d deep; recursion has to end within that at compile time", call.Value, maxInlineDepth))
+	}
+	inlineDepth++
+	defer func() {
+		inlineDepth--
+	}()
+	funcNode = renameLocals(funcNode)
+
+	var foldedParams []*Node
+	for paramIndex, param := range call.Params {
+		if isStructType(funcNode.Params[paramIndex].DType) {
+			foldedParams = append(foldedParams, structVariable(funcNode.Params[paramIndex]))
+		}
+
+		paramNode := Node{
+			DType: "OP",
+			Type:  "ASSIGN",
+			Value: "=",
+			Right: fold(root, param, index),
+			Left:  funcNode.Params[paramIndex],
+			Pos:   param.Pos,
+		}
+		foldedParams = append(foldedParams, &paramNode)
+	}
+
+	return foldFunction(funcNode, foldedParams, index)
+}
+
+// renameLocals copies a function with its params and locals renamed to
+// "x.N", so that the call being inlined stores them apart from the variables
+// of the code around it and of every other call, one to the same function
+// included
+func renameLocals(funcNode *Node) *Node {
+	names := make(map[string]string)
+	for _, local := range functionLocals[funcNode.Value] {
+		shadowCount++
+		names[local] = local + "." + strconv.Itoa(shadowCount)
+	}
+
+	renamed := deepCopyNode(funcNode)
+	renameStorage(renamed, names)
+	return renamed
+}
+
+// renameStorage renames the variables in node, and the fields of those that
+// are structs, by names
+func renameStorage(node *Node, names map[string]string) {
+	if node == nil {
+		return
+	}
+
+	switch node.Type {
+	case "IDENTIFIER", "DECLARATION", "CONST_DECL", "STRUCT_VAR", "ARRAY_DECL", "ARRAY_VAR", "ARRAY_INDEX", "ARRAY_ELEMENT":
+		// "p.x" is renamed with p, unless it is a renamed variable itself
+		for base := node.Value; ; {
+			if name, exists := names[base]; exists {
+				node.Value = name + node.Value[len(base):]
+				break
+			}
+			cut := strings.LastIndex(base, ".")
+			if cut < 0 {
+				break
+			}
+			base = base[:cut]
+		}
+	}
+
+	renameStorage(node.Left, names)
+	renameStorage(node.Right, names)
+	for _, child := range slices.Concat(node.Params, node.Returns, node.Body) {
+		renameStorage(child, names)
+	}
+}
+
 func fold(root *Node, node *Node, index int) *Node {
 	if node == nil {
 		return nil
 	}
 
 	switch node.Type {
-	case "ADD", "SUB", "MULT", "DIV":
+	case "ADD", "SUB", "MULT", "DIV", "MODULO", "NEGATE",
+		"BIT_AND", "BIT_OR", "BIT_XOR", "BIT_NOT", "SHIFT_LEFT", "SHIFT_RIGHT", "SHIFT_RIGHT_LOGICAL":
 		return handleArithmetic(root, node, index)
 	case "IDENTIFIER":
 		valueTableNode := searchValueTable(Values, node.Value)
@@ -190,66 +415,84 @@ func fold(root *Node, node *Node, index int) *Node {
 		}
 		return node // Return the identifier if not found
 	case "ASSIGN":
+		if isStructType(node.Left.DType) {
+			return &Node{Type: "BLOCK", Body: assignFields(root, node, index)}
+		}
+		if isArrayType(node.Left.DType) {
+			return &Node{Type: "BLOCK", Body: assignElements(root, node, index)}
+		}
+
 		node.Right = fold(root, node.Right, index)
+		if node.Left.Type == "ARRAY_INDEX" || node.Left.Type == "ARRAY_ELEMENT" {
+			node.Left = arrayElement(root, node.Left, index)
+			updateElement(node)
+			return node
+		}
 		updateValueTable(&Values, node)
 		return node
+	case "ARRAY_VAR":
+		// a declared array starts with every element zeroed
+		Values.Body = append(Values.Body, &Node{
+			Type:  "ASSIGN",
+			Left:  &Node{Type: "IDENTIFIER", Value: node.Value + "[]", DType: scalarType(node.DType)},
+			Right: zeroValue(scalarType(node.DType), node.Pos),
+		})
+		return node
+	case "CONST_DECL":
+		// a const only lives in the value table, every use of it is folded
+		value := fold(root, deepCopyNode(node.Right), index)
+		if isResidual(value) {
+			errorAt(spanOf(node.Right), "The value of const "+node.Value+" must be known at compile time")
+		}
+		updateValueTable(&Values, &Node{
+			Type:  "ASSIGN",
+			Left:  &Node{Type: "IDENTIFIER", Value: node.Value, DType: node.DType},
+			Right: value,
+		})
+		return nil
+	case "STRUCT_LITERAL":
+		for fieldIndex, field := range node.Params {
+			node.Params[fieldIndex] = fold(root, field, index)
+		}
+		return node
+	case "FIELD_ACCESS":
+		// the struct is a variable or a literal once folded
+		base := fold(root, node.Left, index)
+		if base.Type == "STRUCT_LITERAL" {
+			structNode := findStruct(base.DType)
+			return base.Params[slices.Index(structNode.Params, structField(structNode, node.Value))]
+		}
+		return fold(root, &Node{Type: "IDENTIFIER", Value: base.Value + "." + node.Value, DType: node.DType, Pos: node.Pos}, index)
 	case "FUNCTION_CALL":
 		if node.Value == "write" {
 			writeNode := node
 			for paramIndex, param := range writeNode.Params {
 				writeNode.Params[paramIndex] = fold(root, param, index)
 			}
-			return writeNode
+			return writeEnum(writeNode)
 		} else {
-			funcNode := getFunction(&Functions, node.Value)
-			params := node.Params
-
-			if funcNode == nil {
-				fmt.Println("Optimizer: Function Search Returned Nil Results")
-				return nil
-			}
-
-			if len(funcNode.Params) != len(params) {
-				fmt.Println("Optimizer: More parameters than accepted!")
-				os.Exit(3)
-			}
-
-			var foldedParams []*Node
-			for paramIndex, param := range params {
-				paramNode := Node{
-					DType: "OP",
-					Type:  "ASSIGN",
-					Value: "=",
-					Right: fold(root, param, index),
-					Left:  funcNode.Params[paramIndex],
-				}
-				foldedParams = append(foldedParams, &paramNode)
-			}
-
-			foldedFunction := foldFunction(funcNode, foldedParams, index)
-
-			for _, statement := range foldedFunction.Body {
-				if statement.Type == "FUNCTION_DECL" {
-					foldedFunction.Body = append(foldedFunction.Body, statement.Body...)
-				}
-			}
-
-			if foldedFunction.Type == "ASSIGN" {
-				return foldedFunction.Right
+			// the call's value is its return value, and the statements it
+			// runs to get there are emitted before the statement using it
+			body, value := inlineCall(root, node, index)
+			if value == nil {
+				errorAt(node.Pos, "Function "+node.Value+" does not return a value")
 			}
-			return foldedFunction
+			inlinedStatements = append(inlinedStatements, body...)
+			return value
 		}
-	case "ARRAY_INDEX":
-		arrayIndexNode := fold(root, node.Body[0], index)
-		arrayNode := search(root, index, node.Value)
-
-		arrayIndex, _ := strconv.Atoi(arrayIndexNode.Value)
-
-		return arrayNode.Body[arrayIndex]
+	case "ARRAY_INDEX", "ARRAY_ELEMENT":
+		return elementValue(arrayElement(root, node, index))
+	case "CONVERT":
+		return foldConversion(node, fold(root, node.Left, index))
 	case "RETURN":
-		return fold(root, node, index)
+		if len(node.Body) > 0 {
+			node.Body[0] = fold(root, node.Body[0], index)
+		}
+		return node
 	case "IF_STATEMENT":
 		return optimizeIfStatement(root, node, index)
+	case "SWITCH_STATEMENT":
+		return optimizeSwitch(root, node, index)
 	case "ELSE_STATEMENT":
 		// Create new else node with optimized body
 		newElseNode := &Node{
@@ -265,22 +508,280 @@ func fold(root *Node, node *Node, index int) *Node {
 		}
 		return newElseNode
 
-	case "GREATER_THAN_OR_EQUAL_TO", "LESS_THAN_OR_EQUAL_TO", "GREATER_THAN", "LESS_THAN", "EQUALS":
+	case "GREATER_THAN_OR_EQUAL_TO", "LESS_THAN_OR_EQUAL_TO", "GREATER_THAN", "LESS_THAN", "EQUALS", "NOT_EQUAL", "NOT", "AND", "OR":
 		return optimizeComparison(root, node, index)
 
 	case "FOR_LOOP":
 
 		return optimizeForLoop(root, node, index)
 
+	case "WHILE_LOOP", "DO_WHILE_LOOP":
+		return optimizeWhileLoop(root, node, index)
+
+	case "TERNARY":
+		// a constant condition picks its arm, otherwise both are kept
+		condition := fold(root, node.Left, index)
+		if !isResidual(condition) {
+			if boolNode(condition) == "TRUE" {
+				return fold(root, node.Params[0], index)
+			}
+			return fold(root, node.Params[1], index)
+		}
+
+		node.Left = condition
+		for armIndex, arm := range node.Params {
+			node.Params[armIndex] = foldGuarded(root, arm, index)
+		}
+		return node
+
 	default:
 		// Return node as is if no folding is applied
 		return node
 	}
 }
 
-func optimizeComparison(root *Node, node *Node, index int) *Node {
-	// Debugging print
+// writeEnum makes a write of an enum print the name of its member. A value
+// only known at runtime picks the name with a switch, and prints its number
+// if it matches no member
+func writeEnum(writeNode *Node) *Node {
+	value := writeNode.Params[0]
+	enumNode := findEnum(value.DType)
+	if enumNode == nil {
+		return writeNode
+	}
+
+	nameWrite := func(member *Node) *Node {
+		name := &Node{Type: "STRING", DType: "STRING", Value: "\"" + member.Value + "\"", Pos: value.Pos}
+		return &Node{Type: "FUNCTION_CALL", Value: "write", Params: []*Node{name}, Pos: writeNode.Pos}
+	}
+
+	if !isResidual(value) {
+		for _, member := range enumNode.Params {
+			if member.Left.Value == value.Value {
+				return nameWrite(member)
+			}
+		}
+		return writeNode
+	}
+
+	switchNode := &Node{
+		Type:  "SWITCH_STATEMENT",
+		Value: "switch",
+		Left:  value,
+		Pos:   writeNode.Pos,
+	}
+	for _, member := range enumNode.Params {
+		switchNode.Body = append(switchNode.Body, &Node{
+			Type:   "CASE",
+			Value:  "case",
+			Params: []*Node{member.Left},
+			Body:   []*Node{nameWrite(member)},
+			Pos:    writeNode.Pos,
+		})
+	}
+	switchNode.Body = append(switchNode.Body, &Node{
+		Type:  "DEFAULT",
+		Value: "default",
+		Body:  []*Node{writeNode},
+		Pos:   writeNode.Pos,
+	})
+	return switchNode
+}
+
+// assignElements splits the assignment of a whole array, or of a row of
+// one, into one per element. The value is a literal, whose missing
+// elements are zero, or an array or row of the same type being copied
+func assignElements(root *Node, node *Node, index int) []*Node {
+	targets := arrayElements(root, node.Left, node.Left.DType, index)
+	values := arrayElements(root, node.Right, node.Left.DType, index)
+
+	var assignments []*Node
+	for elementIndex, target := range targets {
+		assignments = append(assignments, fold(root, &Node{
+			Type:  "ASSIGN",
+			DType: "OP",
+			Value: "=",
+			Left:  target,
+			Right: values[elementIndex],
+			Pos:   node.Pos,
+		}, index))
+	}
+	return assignments
+}
+
+// arrayElements lists the values an array value of the given type is made
+// of, in the order they are laid out: the elements of an array variable or
+// row, or the values of a literal padded with zeros
+func arrayElements(root *Node, value *Node, dtype string, index int) []*Node {
+	if value.Type == "ARRAY" {
+		var elements []*Node
+		for _, element := range value.Body {
+			if isArrayType(elementType(dtype)) {
+				elements = append(elements, arrayElements(root, element, elementType(dtype), index)...)
+			} else {
+				elements = append(elements, element)
+			}
+		}
+		for len(elements) < arraySize(dtype) {
+			elements = append(elements, zeroValue(scalarType(dtype), value.Pos))
+		}
+		return elements
+	}
+
+	// a row starts where its indexes point, a whole array at 0
+	start := &Node{Type: "INT", DType: "INT", Value: "0", Pos: value.Pos}
+	if value.Type == "ARRAY_INDEX" {
+		start = flatIndex(foldIndexes(root, value, index))
+	}
+
+	var elements []*Node
+	for offset := range arraySize(dtype) {
+		elements = append(elements, &Node{
+			Type:  "ARRAY_ELEMENT",
+			DType: scalarType(dtype),
+			Value: value.Value,
+			Left:  offsetNode(deepCopyNode(start), offset),
+			Pos:   value.Pos,
+		})
+	}
+	return elements
+}
+
+// arrayElement folds an ARRAY_INDEX, or the index of an ARRAY_ELEMENT, into
+// the ARRAY_ELEMENT it reads or writes. An ARRAY_ELEMENT holds the offset of
+// the element in its array's memory, counted in elements, in Left
+func arrayElement(root *Node, node *Node, index int) *Node {
+	offset := node.Left
+	if node.Type == "ARRAY_INDEX" {
+		offset = flatIndex(foldIndexes(root, node, index))
+	}
+
+	return &Node{
+		Type:  "ARRAY_ELEMENT",
+		DType: node.DType,
+		Value: node.Value,
+		Left:  fold(root, offset, index),
+		Pos:   node.Pos,
+	}
+}
+
+// foldIndexes folds every index of an ARRAY_INDEX, reporting those known
+// to be out of range. The node itself is left as it is
+func foldIndexes(root *Node, node *Node, index int) *Node {
+	folded := deepCopyNode(node)
+	dtype := node.Left.DType
+	for indexNumber, arrayIndex := range node.Body {
+		folded.Body[indexNumber] = fold(root, folded.Body[indexNumber], index)
+		checkArrayIndex(arrayIndex, folded.Body[indexNumber], node.Value, arrayLength(dtype))
+		dtype = elementType(dtype)
+	}
+	return folded
+}
+
+// flatIndex is the expression for the offset of what an ARRAY_INDEX picks,
+// counted in elements: every index times the size of the rows it steps over
+func flatIndex(node *Node) *Node {
+	var offset *Node
+	dtype := node.Left.DType
+	for _, arrayIndex := range node.Body {
+		dtype = elementType(dtype)
+
+		term := arrayIndex
+		if stride := arraySize(dtype); stride > 1 {
+			term = &Node{Type: "MULT", DType: "INT", Value: "*", Left: arrayIndex, Right: &Node{Type: "INT", DType: "INT", Value: strconv.Itoa(stride), Pos: arrayIndex.Pos}, Pos: arrayIndex.Pos}
+		}
+
+		if offset == nil {
+			offset = term
+		} else {
+			offset = &Node{Type: "ADD", DType: "INT", Value: "+", Left: offset, Right: term, Pos: arrayIndex.Pos}
+		}
+	}
+	return offset
+}
+
+// offsetNode is start moved on by a constant number of elements
+func offsetNode(start *Node, offset int) *Node {
+	if offset == 0 {
+		return start
+	}
+	return &Node{Type: "ADD", DType: "INT", Value: "+", Left: start, Right: &Node{Type: "INT", DType: "INT", Value: strconv.Itoa(offset), Pos: start.Pos}, Pos: start.Pos}
+}
+
+// elementValue is the value of an array element when it is known at
+// compile time, or the element itself for the generated code to load
+func elementValue(element *Node) *Node {
+	offset, known := intValue(element.Left)
+	if !known {
+		return element
+	}
+
+	// the newest entry for this element, or for the whole array, decides
+	key := fmt.Sprintf("%s[%d]", element.Value, offset)
+	for i := len(Values.Body) - 1; i >= 0; i-- {
+		entry := Values.Body[i]
+		if entry.Left.Value == key || entry.Left.Value == element.Value+"[]" {
+			if isResidual(entry.Right) {
+				return element
+			}
+			return entry.Right
+		}
+	}
+	return element
+}
+
+// updateElement records the value an assignment stores in an array
+// element, as "a[3]" in the value table. A store at an index only known at
+// runtime may change any element, which "a[]" marks
+func updateElement(node *Node) {
+	element := node.Left
+	offset, known := intValue(element.Left)
+	if !known {
+		Values.Body = append(Values.Body, unknownValue(&Node{Value: element.Value + "[]", DType: element.DType}))
+		return
+	}
+
+	updateValueTable(&Values, &Node{
+		Type:  "ASSIGN",
+		Left:  &Node{Type: "IDENTIFIER", Value: fmt.Sprintf("%s[%d]", element.Value, offset), DType: element.DType},
+		Right: node.Right,
+	})
+}
+
+// assignFields splits the assignment of a struct into one per field, which
+// is how structs are copied, passed and returned
+func assignFields(root *Node, node *Node, index int) []*Node {
+	value := fold(root, node.Right, index)
+	if value.Type != "IDENTIFIER" && value.Type != "STRUCT_LITERAL" {
+		errorAt(spanOf(node), "Cannot assign "+value.Value+" ("+value.DType+") to struct "+node.Left.Value)
+	}
+
+	var assignments []*Node
+	for fieldIndex, field := range findStruct(node.Left.DType).Params {
+		fieldValue := &Node{Type: "IDENTIFIER", Value: value.Value + "." + field.Value, DType: field.DType, Pos: value.Pos}
+		if value.Type == "STRUCT_LITERAL" {
+			fieldValue = value.Params[fieldIndex]
+		}
 
+		assignment := fold(root, &Node{
+			Type:  "ASSIGN",
+			DType: "OP",
+			Value: "=",
+			Left:  &Node{Type: "IDENTIFIER", Value: node.Left.Value + "." + field.Value, DType: field.DType, Pos: node.Left.Pos},
+			Right: fieldValue,
+			Pos:   node.Pos,
+		}, index)
+
+		if assignment.Type == "BLOCK" {
+			assignments = append(assignments, assignment.Body...)
+		} else {
+			assignments = append(assignments, assignment)
+		}
+	}
+	return assignments
+}
+
+func optimizeComparison(root *Node, node *Node, index int) *Node {
 	leftNode := node.Left
 	rightNode := node.Right
 
@@ -296,10 +797,52 @@ func optimizeComparison(root *Node, node *Node, index int) *Node {
 		Value: "FALSE",
 	}
 
+	// Logical not only has a left operand
+	if node.Type == "NOT" {
+		operand := fold(root, leftNode, index)
+		if operand != nil {
+			switch operand.Value {
+			case "TRUE", "True":
+				return &boolFalse
+			case "FALSE", "False":
+				return &boolTrue
+			}
+		}
+		node.Left = operand
+		return node
+	}
+
+	// && and || short-circuit: the right operand is only folded when
+	// the left one doesn't already decide the result
+	if node.Type == "AND" || node.Type == "OR" {
+		decided, undecided := &boolFalse, &boolTrue
+		if node.Type == "OR" {
+			decided, undecided = &boolTrue, &boolFalse
+		}
+
+		leftNode = fold(root, leftNode, index)
+		if isResidual(leftNode) {
+			node.Left = leftNode
+			node.Right = foldGuarded(root, rightNode, index)
+			return node
+		}
+		if boolNode(leftNode) == decided.Value {
+			return decided
+		}
+
+		rightNode = fold(root, rightNode, index)
+		if isResidual(rightNode) {
+			return rightNode
+		}
+		if boolNode(rightNode) == decided.Value {
+			return decided
+		}
+		return undecided
+	}
+
 	// Ensure left and right nodes are not nil
 	if leftNode == nil || rightNode == nil {
-		fmt.Println("Optimizer: Comparison of Nil Nodes")
-		return node
+		errorAt(node.Pos, "Comparison "+node.Value+" is missing an operand")
 	}
 
 	// Resolve identifiers to their most recent values
@@ -316,87 +859,128 @@ func optimizeComparison(root *Node, node *Node, index int) *Node {
 		}
 	}
 
-	// Resolve ARRAY_INDEX nodes
-	if leftNode.Type == "ARRAY_INDEX" {
-		resolvedLeft := fold(root, leftNode, index)
-		if resolvedLeft != nil {
-			leftNode = resolvedLeft
-		}
+	// Resolve subtrees that are expressions or calls
+	if isResidual(leftNode) || needsFolding(leftNode) {
+		leftNode = fold(root, leftNode, index)
 	}
-	if rightNode.Type == "ARRAY_INDEX" {
-		resolvedRight := fold(root, rightNode, index)
-		if resolvedRight != nil {
-			rightNode = resolvedRight
-		}
+	if isResidual(rightNode) || needsFolding(rightNode) {
+		rightNode = fold(root, rightNode, index)
 	}
 
-	// Validate node types
-	if leftNode.Type != "INT" || rightNode.Type != "INT" {
-		fmt.Printf("Comparison: Invalid node types. Left: %s, %s, Right: %s\n", leftNode.Type, node.Value, rightNode.Type)
-		os.Exit(3)
+	// Operands only known at runtime leave the comparison to the generated code
+	if isResidual(leftNode) || isResidual(rightNode) {
+		node.Left = leftNode
+		node.Right = rightNode
 		return node
 	}
 
-	// Convert to integers
-	leftVal := atoi(leftNode.Value)
-	rightVal := atoi(rightNode.Value)
+	// The parser promoted both operands to the same type, so they are
+	// ordered by what that type holds
+	var order int
+	switch leftNode.Type {
+	case "FLOAT":
+		leftVal, _ := strconv.ParseFloat(leftNode.Value, 64)
+		rightVal, _ := strconv.ParseFloat(rightNode.Value, 64)
+		order = cmp.Compare(leftVal, rightVal)
+	case "CHAR":
+		// literals hold their decoded char between the quotes. Chars are
+		// unsigned bytes, like they load at runtime
+		order = cmp.Compare(leftNode.Value[1], rightNode.Value[1])
+	case "BOOL":
+		// false orders before true
+		order = cmp.Compare(boolNode(leftNode), boolNode(rightNode))
+	case "STRING":
+		// byte by byte between the quotes, like strcmp at runtime
+		order = cmp.Compare(unquoteLiteral(leftNode.Value), unquoteLiteral(rightNode.Value))
+	default:
+		// ints and enum members
+		order = cmp.Compare(atoi(leftNode.Value), atoi(rightNode.Value))
+	}
 
-	// Perform comparison
-	var result *Node
+	var holds bool
 	switch node.Type {
 	case "GREATER_THAN":
-		if leftVal > rightVal {
-			result = &boolTrue
-		} else {
-			result = &boolFalse
-		}
+		holds = order > 0
 	case "LESS_THAN":
-		if leftVal < rightVal {
-			result = &boolTrue
-		} else {
-			result = &boolFalse
-		}
+		holds = order < 0
 	case "GREATER_THAN_OR_EQUAL_TO":
-		if leftVal >= rightVal {
-			result = &boolTrue
-		} else {
-			result = &boolFalse
-		}
+		holds = order >= 0
 	case "LESS_THAN_OR_EQUAL_TO":
-		if leftVal <= rightVal {
-			result = &boolTrue
-		} else {
-			result = &boolFalse
-		}
+		holds = order <= 0
 	case "EQUALS":
-		if leftVal == rightVal {
-			result = &boolTrue
-		} else {
-			result = &boolFalse
-		}
+		holds = order == 0
 	case "NOT_EQUAL":
-		if leftVal != rightVal {
-			result = &boolTrue
-		} else {
-			result = &boolFalse
+		holds = order != 0
+	}
+
+	if holds {
+		return &boolTrue
+	}
+	return &boolFalse
+}
+
+func handleArithmetic(root *Node, node *Node, index int) *Node {
+	leftNode := node.Left
+	rightNode := node.Right
+
+	// Unary minus only has a left operand
+	if node.Type == "NEGATE" {
+		operand := fold(root, leftNode, index)
+		if isResidual(operand) {
+			node.Left = operand
+			return node
 		}
-	default:
-		fmt.Println("Unknown comparison type")
+
+		switch operand.DType {
+		case "INT":
+			intVal, err := strconv.Atoi(operand.Value)
+			if err != nil {
+				return node
+			}
+			node.Value = strconv.Itoa(-intVal)
+		case "FLOAT":
+			floatVal, err := strconv.ParseFloat(operand.Value, 64)
+			if err != nil {
+				return node
+			}
+			node.Value = strconv.FormatFloat(-floatVal, 'f', -1, 64)
+		default:
+			return node
+		}
+
+		node.Type = operand.DType
+		node.DType = operand.DType
+		node.Left = nil
 		return node
 	}
 
-	return result
-}
+	// Bitwise not flips every bit of the 32-bit word
+	if node.Type == "BIT_NOT" {
+		operand := fold(root, leftNode, index)
+		if isResidual(operand) {
+			node.Left = operand
+			return node
+		}
 
-func handleArithmetic(root *Node, node *Node, index int) *Node {
-	leftNode := node.Left
-	rightNode := node.Right
+		intVal, err := strconv.Atoi(operand.Value)
+		if err != nil {
+			return node
+		}
+		node.Value = strconv.Itoa(int(^int32(intVal)))
+		node.Type = "INT"
+		node.DType = "INT"
+		node.Left = nil
+		return node
+	}
 
 	// Ensure left and right nodes are not nil
 	if leftNode == nil || rightNode == nil {
 		return node
 	}
 
+	// folding the operands rewrites them in place, so take the span for errors first
+	span := spanOf(node)
+
 	// Resolve identifiers to their values, if necessary
 	if leftNode.Type == "IDENTIFIER" {
 		resolvedLeft := searchValueTable(Values, leftNode.Value)
@@ -411,104 +995,102 @@ func handleArithmetic(root *Node, node *Node, index int) *Node {
 		}
 	}
 
-	// Resolve ARRAY_INDEX nodes
-	if leftNode.Type == "ARRAY_INDEX" {
-		resolvedLeft := fold(root, leftNode, index)
-		if resolvedLeft != nil {
-			leftNode = resolvedLeft
-		}
+	// Resolve subtrees that are arithmetic expressions or calls
+	if isArithmetic(leftNode) || needsFolding(leftNode) {
+		leftNode = fold(root, leftNode, index)
 	}
-	if rightNode.Type == "ARRAY_INDEX" {
-		resolvedRight := fold(root, rightNode, index)
-		if resolvedRight != nil {
-			rightNode = resolvedRight
-		}
+	if isArithmetic(rightNode) || needsFolding(rightNode) {
+		rightNode = fold(root, rightNode, index)
 	}
 
-	// Resolve subtrees that are arithmetic expressions
-	if leftNode.Type == "ADD" || leftNode.Type == "SUB" || leftNode.Type == "MULT" || leftNode.Type == "DIV" {
-		leftNode = fold(root, leftNode, index)
+	// Operands only known at runtime leave the arithmetic to the generated code
+	if isResidual(leftNode) || isResidual(rightNode) {
+		if leftNode.DType == "STRING" {
+			errorAt(span, "Strings can only be joined when both are known at compile time")
+		}
+		node.Left = leftNode
+		node.Right = rightNode
+		return node
 	}
-	if rightNode.Type == "ADD" || rightNode.Type == "SUB" || rightNode.Type == "MULT" || rightNode.Type == "DIV" {
-		rightNode = fold(root, rightNode, index)
+
+	if isBitwise(node) {
+		return foldBitwise(node, leftNode, rightNode)
 	}
 
-	// Perform arithmetic operation if types are compatible
-	if (leftNode.DType == "INT" || leftNode.DType == "FLOAT") && (rightNode.DType == "INT" || rightNode.DType == "FLOAT") {
-		var leftVal, rightVal float64
-		var err error
+	// The parser promoted both operands to the type of the node. Ints wrap
+	// around and divide towards zero like the 32-bit MIPS instructions
+	if node.DType == "INT" && leftNode.DType == "INT" && rightNode.DType == "INT" {
+		leftVal, rightVal := int32(atoi(leftNode.Value)), int32(atoi(rightNode.Value))
 
-		// Convert left value
-		if leftNode.DType == "INT" {
-			intVal, _ := strconv.Atoi(leftNode.Value)
-			leftVal = float64(intVal)
-		} else {
-			leftVal, err = strconv.ParseFloat(leftNode.Value, 64)
-			if err != nil {
-				fmt.Println("Error parsing left float:", err)
-				os.Exit(3)
+		var result int32
+		switch node.Type {
+		case "ADD":
+			result = leftVal + rightVal
+		case "SUB":
+			result = leftVal - rightVal
+		case "MULT":
+			result = leftVal * rightVal
+		case "DIV":
+			if rightVal == 0 {
+				errorAt(span, "Division by zero!")
+			}
+			result = leftVal / rightVal
+		case "MODULO":
+			if rightVal == 0 {
+				errorAt(span, "Modulo by zero!")
 			}
+			result = leftVal % rightVal
+		default:
+			errorAt(span, "Cannot fold the "+node.Value+" operator")
 		}
 
-		// Convert right value
-		if rightNode.DType == "INT" {
-			intVal, _ := strconv.Atoi(rightNode.Value)
-			rightVal = float64(intVal)
-		} else {
-			rightVal, err = strconv.ParseFloat(rightNode.Value, 64)
-			if err != nil {
-				fmt.Println("Error parsing right float:", err)
-				os.Exit(3)
-			}
+		node.Value = strconv.Itoa(int(result))
+		node.Type = "INT"
+		node.Left = nil
+		node.Right = nil
+		return node
+	}
+
+	if node.DType == "FLOAT" && leftNode.DType == "FLOAT" && rightNode.DType == "FLOAT" {
+		leftVal, err := strconv.ParseFloat(leftNode.Value, 64)
+		if err != nil {
+			errorAt(leftNode.Pos, "Error parsing left float: "+err.Error())
+		}
+		rightVal, err := strconv.ParseFloat(rightNode.Value, 64)
+		if err != nil {
+			errorAt(rightNode.Pos, "Error parsing right float: "+err.Error())
 		}
 
-		// Perform the operation based on the node type
+		var result float64
 		switch node.Type {
 		case "ADD":
-			node.Value = strconv.FormatFloat(leftVal+rightVal, 'f', -1, 64)
+			result = leftVal + rightVal
 		case "SUB":
-			node.Value = strconv.FormatFloat(leftVal-rightVal, 'f', -1, 64)
+			result = leftVal - rightVal
 		case "MULT":
-			node.Value = strconv.FormatFloat(leftVal*rightVal, 'f', -1, 64)
+			result = leftVal * rightVal
 		case "DIV":
 			if rightVal == 0 {
-				fmt.Println("Error: Division by zero!")
-				os.Exit(3)
+				errorAt(span, "Division by zero!")
 			}
-			node.Value = strconv.FormatFloat(leftVal/rightVal, 'f', -1, 64)
+			result = leftVal / rightVal
 		default:
-			fmt.Println("Unknown operation")
-			return node
-		}
-
-		// Determine the resulting type
-		if leftNode.DType == "FLOAT" || rightNode.DType == "FLOAT" {
-			node.DType = "FLOAT"
-		} else {
-			// Check if the result can remain an integer
-			intResult, err := strconv.Atoi(node.Value)
-			if err == nil && strconv.FormatInt(int64(intResult), 10) == node.Value {
-				node.DType = "INT"
-				node.Value = strconv.Itoa(intResult)
-			} else {
-				node.DType = "FLOAT"
-			}
+			errorAt(span, "Cannot fold the "+node.Value+" operator")
 		}
 
-		// Cleanup the current node
+		node.Value = floatLiteral(result)
+		node.Type = "FLOAT"
 		node.Left = nil
 		node.Right = nil
-		node.Type = "INT"
+		return node
 	}
 
 	// After resolution, check if both nodes are numbers
 	if leftNode.DType == "STRING" && rightNode.DType == "STRING" {
-		// Regular expression to match non-escaped quotes
-		re := regexp.MustCompile(`(^|[^\\])"`)
-
-		// Remove non-escaped quotes from each string
-		cleanLeft := re.ReplaceAllString(leftNode.Value, `$1`)
-		cleanRight := re.ReplaceAllString(rightNode.Value, `$1`)
+		// Literals hold their decoded text between the quotes, so only the
+		// outer quotes need to go
+		cleanLeft := leftNode.Value[1 : len(leftNode.Value)-1]
+		cleanRight := rightNode.Value[1 : len(rightNode.Value)-1]
 
 		switch node.Type {
 		case "ADD":
@@ -518,14 +1100,146 @@ func handleArithmetic(root *Node, node *Node, index int) *Node {
 			node.Left = nil
 			node.Right = nil
 		default:
-			fmt.Println("Unsupported string operation between", leftNode.Value, "and", rightNode.Value)
-			os.Exit(3)
+			errorAt(span, "Unsupported string operation between "+leftNode.Value+" and "+rightNode.Value)
+		}
+	}
+
+	return node
+}
+
+// foldConversion converts a folded value the way the generated code would
+// at runtime: int(f) rounds to the nearest int, halves to even, like
+// cvt.w.s, and int(c) gives the char's byte from 0 to 255. A value only
+// known at runtime is left for the generated code to convert
+func foldConversion(node *Node, value *Node) *Node {
+	if isResidual(value) {
+		node.Left = value
+		return node
+	}
+
+	converted := &Node{Type: node.DType, DType: node.DType, Pos: node.Pos}
+	switch tacType(value.DType) + " to " + node.DType {
+	case "INT to FLOAT":
+		converted.Value = floatLiteral(float64(float32(atoi(value.Value))))
+	case "FLOAT to INT":
+		floatVal, _ := strconv.ParseFloat(value.Value, 32)
+		rounded := math.RoundToEven(floatVal)
+		if rounded < math.MinInt32 || rounded > math.MaxInt32 {
+			errorAt(spanOf(node), "Cannot convert "+value.Value+" to int, it is outside the 32-bit range")
 		}
+		converted.Value = strconv.Itoa(int(rounded))
+	case "INT to CHAR":
+		converted.Value = "'" + string([]byte{byte(atoi(value.Value))}) + "'"
+	case "CHAR to INT":
+		// literals hold their decoded char between the quotes
+		converted.Value = strconv.Itoa(int(value.Value[1]))
+	case "CHAR to FLOAT":
+		converted.Value = floatLiteral(float64(value.Value[1]))
+	case "INT to STRING":
+		converted.Value = "\"" + value.Value + "\""
+	default:
+		// to its own type, or an enum to int
+		converted.Type = value.Type
+		converted.Value = value.Value
+	}
+	return converted
+}
+
+// floatLiteral writes a float value as a literal, always with a decimal
+// point so it can't be taken for an int
+func floatLiteral(value float64) string {
+	literal := strconv.FormatFloat(value, 'f', -1, 32)
+	if !strings.Contains(literal, ".") {
+		literal += ".0"
+	}
+	return literal
+}
+
+func isArithmetic(node *Node) bool {
+	switch node.Type {
+	case "ADD", "SUB", "MULT", "DIV", "MODULO", "NEGATE":
+		return true
+	}
+	return isBitwise(node)
+}
+
+func isBitwise(node *Node) bool {
+	switch node.Type {
+	case "BIT_AND", "BIT_OR", "BIT_XOR", "BIT_NOT", "SHIFT_LEFT", "SHIFT_RIGHT", "SHIFT_RIGHT_LOGICAL":
+		return true
+	}
+	return false
+}
+
+// foldBitwise computes a bitwise operator or shift on two int constants the
+// way the MIPS instruction would: on 32-bit words, with shift counts taken
+// from their low 5 bits
+func foldBitwise(node *Node, leftNode *Node, rightNode *Node) *Node {
+	leftVal, _ := strconv.Atoi(leftNode.Value)
+	rightVal, _ := strconv.Atoi(rightNode.Value)
+	left, right := int32(leftVal), int32(rightVal)
+	count := uint32(right) & 31
+
+	var result int32
+	switch node.Type {
+	case "BIT_AND":
+		result = left & right
+	case "BIT_OR":
+		result = left | right
+	case "BIT_XOR":
+		result = left ^ right
+	case "SHIFT_LEFT":
+		result = left << count
+	case "SHIFT_RIGHT":
+		result = left >> count
+	case "SHIFT_RIGHT_LOGICAL":
+		result = int32(uint32(left) >> count)
 	}
 
+	node.Value = strconv.Itoa(int(result))
+	node.Type = "INT"
+	node.DType = "INT"
+	node.Left = nil
+	node.Right = nil
 	return node
 }
 
+// isResidual reports whether a folded value still depends on something only
+// known at runtime, so the generated code has to compute it
+func isResidual(node *Node) bool {
+	if node == nil {
+		return false
+	}
+
+	switch node.Type {
+	case "IDENTIFIER", "ARRAY_ELEMENT", "CONVERT", "NOT", "AND", "OR", "TERNARY", "INLINED",
+		"EQUALS", "NOT_EQUAL", "LESS_THAN", "GREATER_THAN", "LESS_THAN_OR_EQUAL_TO", "GREATER_THAN_OR_EQUAL_TO":
+		return true
+	}
+	return isArithmetic(node)
+}
+
+// needsFolding reports an operand that only has a value once folded: a
+// call, a struct field, an array element, a conversion or a ternary
+func needsFolding(node *Node) bool {
+	switch node.Type {
+	case "FUNCTION_CALL", "FIELD_ACCESS", "ARRAY_INDEX", "CONVERT", "TERNARY":
+		return true
+	}
+	return false
+}
+
+// boolNode normalizes a folded bool literal to TRUE or FALSE
+func boolNode(node *Node) string {
+	switch node.Value {
+	case "TRUE", "True":
+		return "TRUE"
+	case "FALSE", "False":
+		return "FALSE"
+	}
+	return ""
+}
+
 func search(root *Node, searchBehind int, value string) *Node {
 	for i := searchBehind - 1; i >= 0; i-- {
 		if root.Body[i].Type == "ASSIGN" {
@@ -537,48 +1251,54 @@ func search(root *Node, searchBehind int, value string) *Node {
 	return nil
 }
 
-func searchForFunctions(root *Node, searchBehind int, value string) *Node {
-	// First, search in the current context
-	for i := searchBehind - 1; i >= 0; i-- {
-		if root.Body[i].Value == value && root.Body[i].Type == "FUNCTION_DECL" {
-			return root.Body[i]
+// foldFunction folds the body of a called function, params being the
+// assignments of its arguments. The function stops at the first return it
+// reaches, whose value is returned apart from the statements run before it
+func foldFunction(funcNode *Node, params []*Node, index int) (body []*Node, value *Node) {
+	// Deep copy the function node to prevent parameter persistence
+	foldedFunction := deepCopyNode(funcNode)
+
+	// Add parameters to the beginning of the copied function body
+	foldedFunction.Body = append(params, foldedFunction.Body...)
+
+	body = foldStatements(foldedFunction, foldedFunction.Body, index)
+
+	if len(body) > 0 && body[len(body)-1].Type == "RETURN" {
+		// a bare return ends the call without a value
+		if returned := body[len(body)-1].Body; len(returned) > 0 {
+			value = returned[0]
 		}
+		body = body[:len(body)-1]
 	}
 
-	// If not found, try a broader search or add a global function table
-	fmt.Printf("Warning: Function %s not found\n", value)
-	return nil
+	// a return that is only reached at runtime can't give the call a value
+	for _, statement := range body {
+		if nested := findReturn(statement); nested != nil {
+			errorAt(nested.Pos, "A return inside an if, switch or loop decided at runtime is not supported")
+		}
+	}
+
+	return body, value
 }
 
-func foldFunction(funcNode *Node, params []*Node, index int) *Node {
-	// Deep copy the function node to prevent parameter persistence
-	foldedFunction := deepCopyNode(funcNode)
+// findReturn returns the first return nested in node, or nil
+func findReturn(node *Node) *Node {
+	if node == nil {
+		return nil
+	}
+	if node.Type == "RETURN" {
+		return node
+	}
 
-	// Add parameters to the beginning of the copied function body
-	for _, param := range params {
-		foldedFunction.Body = prependNode(foldedFunction.Body, param)
-	}
-
-	// Create a new node to store folded statements
-	resultNode := &Node{}
-	resultNode.Value, resultNode.Type, resultNode.DType = foldedFunction.Value, foldedFunction.Type, foldedFunction.DType
-	for funcIndex, statement := range foldedFunction.Body {
-		result := fold(foldedFunction, statement, funcIndex)
-		if result != nil {
-			if result.Type == "IF_STATEMENT" {
-				if result.Left.Value == "FALSE" || result.Left.Value == "TRUE" {
-					resultNode.Body = append(resultNode.Body, result.Body...)
-				} else {
-					resultNode.Body = append(resultNode.Body, result)
-				}
-			} else {
-				resultNode.Body = append(resultNode.Body, result)
-			}
+	if nested := findReturn(node.Right); nested != nil {
+		return nested
+	}
+	for _, child := range node.Body {
+		if nested := findReturn(child); nested != nil {
+			return nested
 		}
 	}
-
-	// Return the last statement of the function
-	return resultNode
+	return nil
 }
 
 // deepCopyNode creates a complete recursive copy of a node
@@ -591,6 +1311,7 @@ func deepCopyNode(node *Node) *Node {
 		Type:  node.Type,
 		DType: node.DType,
 		Value: node.Value,
+		Pos:   node.Pos,
 	}
 
 	// Deep copy Left and Right
@@ -624,40 +1345,297 @@ func optimizeForLoop(root *Node, forLoopNode *Node, index int) *Node {
 	init := forLoopNode.Body[0]
 	updation := forLoopNode.Body[len(forLoopNode.Body)-1]
 
+	snapshot := len(Values.Body)
+
 	// Analyze the initialization, condition, and updation
 	loopVar := init.Left.Value
-	start := atoi(init.Right.Value)
-	end := atoi(condition.Right.Value)
-	step := 1
-
-	if updation.Right.Type == "ADD" {
-		step = atoi(updation.Right.Right.Value)
+	foldedInit := fold(root, deepCopyNode(init), index)
+	start, knownStart := intValue(foldedInit.Right)
+	end, knownEnd := intValue(fold(root, deepCopyNode(condition.Right), index))
+	step, knownStep := loopStep(updation, loopVar)
+
+	// Only a counter with constant bounds that is sure to reach its end is unrolled
+	if !knownStart || !knownEnd || !knownStep || condition.Left.Type != "IDENTIFIER" || condition.Left.Value != loopVar || !loopEnds(condition.Type, start, end, step) {
+		Values.Body = Values.Body[:snapshot]
+		return runtimeForLoop(root, forLoopNode, index)
 	}
 
 	// Generate the optimized body by simulating the loop execution
-	unrolledLoop := Node{}
-	unrolledLoop.Body = append(unrolledLoop.Body, init)
+	unrolledLoop := Node{Type: "BLOCK"}
+	unrolledLoop.Body = append(unrolledLoop.Body, foldedInit)
+
+	iterations := 0
+	for i := start; loopContinues(condition.Type, i, end); i += step {
+		iterations++
+		if iterations > maxUnrolledIterations {
+			Values.Body = Values.Body[:snapshot]
+			warnCappedLoop(forLoopNode)
+			return runtimeForLoop(root, forLoopNode, index)
+		}
 
-	for i := start; i < end; i += step {
+		var iteration []*Node
 		for _, stmt := range forLoopNode.Body[1 : len(forLoopNode.Body)-1] {
-			// Replace loop variable with current iteration value
-			replacedStmt := replaceLoopVar(stmt, loopVar, strconv.Itoa(i))
-
 			// Handle if statement body separately
 			if stmt.Type == "IF_STATEMENT" {
 				for _, bodyStmt := range stmt.Body {
-					replacedBodyStmt := replaceLoopVar(bodyStmt, loopVar, strconv.Itoa(i))
-					unrolledLoop.Body = append(unrolledLoop.Body, replacedBodyStmt)
+					// Replace loop variable with current iteration value
+					iteration = append(iteration, replaceLoopVar(bodyStmt, loopVar, strconv.Itoa(i)))
 				}
 			} else {
-				unrolledLoop.Body = append(unrolledLoop.Body, replacedStmt)
+				iteration = append(iteration, replaceLoopVar(stmt, loopVar, strconv.Itoa(i)))
+			}
+		}
+
+		exit, ok := unrollIteration(root, iteration, index, &unrolledLoop)
+		if !ok {
+			Values.Body = Values.Body[:snapshot]
+			return runtimeForLoop(root, forLoopNode, index)
+		}
+		if exit == "BREAK" || exit == "RETURN" {
+			break
+		}
+	}
+
+	return &unrolledLoop
+}
+
+// maxUnrolledIterations is how many iterations a loop may run at compile
+// time. A loop that needs more is left for runtime
+const maxUnrolledIterations = 1000
+
+// cappedLoops are the loops already warned about hitting maxUnrolledIterations,
+// so a loop nested in one being unrolled is only reported once
+var cappedLoops = make(map[Position]bool)
+
+// warnCappedLoop warns that a loop ran maxUnrolledIterations at compile time
+// without ending, and is left for runtime
+func warnCappedLoop(loopNode *Node) {
+	if !cappedLoops[loopNode.Pos] {
+		cappedLoops[loopNode.Pos] = true
+		warningAt(loopNode.Pos, fmt.Sprintf("Loop is still running after %d iterations at compile time, it is left for runtime", maxUnrolledIterations))
+	}
+}
+
+// unrollIteration folds the statements of one loop iteration onto unrolled.
+// exit is "BREAK" or "CONTINUE" when one of them ends the iteration early. ok
+// is false if a break or continue is under a runtime condition, as then the
+// iteration can't be unrolled
+func unrollIteration(root *Node, iteration []*Node, index int, unrolled *Node) (exit string, ok bool) {
+	for _, foldedStmt := range foldStatements(root, iteration, index) {
+		if isLoopExit(foldedStmt) {
+			return foldedStmt.Type, true
+		}
+		if foldedStmt.Type == "RETURN" {
+			// the return leaves the loop and the function it's in
+			unrolled.Body = append(unrolled.Body, foldedStmt)
+			return foldedStmt.Type, true
+		}
+		if containsLoopExit(foldedStmt) {
+			return "", false
+		}
+		unrolled.Body = append(unrolled.Body, foldedStmt)
+	}
+	return "", true
+}
+
+// optimizeWhileLoop runs a while or do-while loop at compile time for as long
+// as its condition folds to a constant. A condition only known at runtime, or
+// one still true after maxUnrolledIterations, keeps the loop for runtime
+func optimizeWhileLoop(root *Node, loopNode *Node, index int) *Node {
+	snapshot := len(Values.Body)
+	inlinedMark := len(inlinedStatements)
+	core := loopNode.Body[0]
+	unrolledLoop := Node{Type: "BLOCK"}
+
+	// undo the iterations run so far, to keep the loop for runtime
+	restore := func() {
+		Values.Body = Values.Body[:snapshot]
+		inlinedStatements = inlinedStatements[:inlinedMark]
+	}
+
+	for iteration := 0; ; iteration++ {
+		if iteration == maxUnrolledIterations {
+			restore()
+			warnCappedLoop(loopNode)
+			return runtimeWhileLoop(root, loopNode, index)
+		}
+
+		// a do-while always runs its body once before checking
+		if loopNode.Type == "WHILE_LOOP" || iteration > 0 {
+			condition := fold(root, deepCopyNode(core.Left), index)
+			if isResidual(condition) {
+				restore()
+				return runtimeWhileLoop(root, loopNode, index)
+			}
+
+			// functions called by the condition run before every check
+			unrolledLoop.Body = append(unrolledLoop.Body, inlinedStatements[inlinedMark:]...)
+			inlinedStatements = inlinedStatements[:inlinedMark]
+
+			if boolNode(condition) == "FALSE" {
+				break
 			}
 		}
+
+		exit, ok := unrollIteration(root, deepCopyNode(core).Body, index, &unrolledLoop)
+		if !ok {
+			restore()
+			return runtimeWhileLoop(root, loopNode, index)
+		}
+		if exit == "BREAK" || exit == "RETURN" {
+			break
+		}
 	}
 
 	return &unrolledLoop
 }
 
+// loopStep reads how much the loop variable changes every iteration from a
+// step like "i = i + 2", "i += 2" or "i--". ok is false if it isn't constant
+func loopStep(updation *Node, loopVar string) (step int, ok bool) {
+	if updation.Type != "ASSIGN" || updation.Left.Value != loopVar {
+		return 0, false
+	}
+
+	change := updation.Right
+	if (change.Type != "ADD" && change.Type != "SUB") || change.Left.Type != "IDENTIFIER" || change.Left.Value != loopVar {
+		return 0, false
+	}
+
+	step, ok = intValue(change.Right)
+	if change.Type == "SUB" {
+		step = -step
+	}
+	return step, ok && step != 0
+}
+
+// loopContinues evaluates a loop condition "i <op> end" for one value of i
+func loopContinues(condition string, i int, end int) bool {
+	switch condition {
+	case "LESS_THAN":
+		return i < end
+	case "LESS_THAN_OR_EQUAL_TO":
+		return i <= end
+	case "GREATER_THAN":
+		return i > end
+	case "GREATER_THAN_OR_EQUAL_TO":
+		return i >= end
+	case "NOT_EQUAL":
+		return i != end
+	}
+	return false
+}
+
+// loopEnds reports whether stepping from start ever makes the condition false
+func loopEnds(condition string, start int, end int, step int) bool {
+	switch condition {
+	case "LESS_THAN", "LESS_THAN_OR_EQUAL_TO":
+		return step > 0 || !loopContinues(condition, start, end)
+	case "GREATER_THAN", "GREATER_THAN_OR_EQUAL_TO":
+		return step < 0 || !loopContinues(condition, start, end)
+	case "NOT_EQUAL":
+		return (end-start)%step == 0 && (end-start)/step >= 0
+	}
+	return false
+}
+
+// intValue is the value of a folded INT literal
+func intValue(node *Node) (int, bool) {
+	if node == nil || node.Type != "INT" {
+		return 0, false
+	}
+	value, err := strconv.Atoi(node.Value)
+	return value, err == nil
+}
+
+// runtimeForLoop folds a for loop that is kept for runtime. Anything assigned
+// in the loop is unknown inside it and after it, as it may run any number of times
+func runtimeForLoop(root *Node, forLoopNode *Node, index int) *Node {
+	loopCopy := deepCopyNode(forLoopNode)
+	init := loopCopy.Body[0]
+	core := loopCopy.Body[1]
+	updation := loopCopy.Body[len(loopCopy.Body)-1]
+
+	init = fold(root, init, index)
+	forgetAssigned(loopCopy)
+
+	foldLoopCondition(root, core, index)
+	core.Body = foldStatements(root, core.Body, index)
+
+	// functions called by the step run with it at the end of every iteration
+	inlinedMark := len(inlinedStatements)
+	updation = fold(root, updation, index)
+	if len(inlinedStatements) > inlinedMark {
+		updation = &Node{Type: "BLOCK", Body: append(inlinedStatements[inlinedMark:], updation)}
+		inlinedStatements = inlinedStatements[:inlinedMark]
+	}
+	forgetAssigned(loopCopy)
+
+	return &Node{
+		Type:   "FOR_LOOP",
+		DType:  "FOR_LOOP",
+		Value:  "for",
+		Params: []*Node{core.Left},
+		Body:   []*Node{init, core, updation},
+		Pos:    forLoopNode.Pos,
+	}
+}
+
+// runtimeWhileLoop folds what it can of a while or do-while loop left for
+// runtime. Everything the loop assigns is unknown from its first check on
+func runtimeWhileLoop(root *Node, loopNode *Node, index int) *Node {
+	loopCopy := deepCopyNode(loopNode)
+	core := loopCopy.Body[0]
+
+	forgetAssigned(loopCopy)
+	foldLoopCondition(root, core, index)
+	core.Body = foldStatements(root, core.Body, index)
+	forgetAssigned(loopCopy)
+
+	return &Node{
+		Type:   loopNode.Type,
+		DType:  loopNode.DType,
+		Value:  loopNode.Value,
+		Params: []*Node{core.Left},
+		Body:   []*Node{core},
+		Pos:    loopNode.Pos,
+	}
+}
+
+// foldLoopCondition folds the condition of a loop kept for runtime. The
+// statements of functions it calls go in the core's Params, as they have to
+// run again before every check
+func foldLoopCondition(root *Node, core *Node, index int) {
+	inlinedMark := len(inlinedStatements)
+	core.Left = fold(root, core.Left, index)
+	core.Params = append([]*Node{}, inlinedStatements[inlinedMark:]...)
+	inlinedStatements = inlinedStatements[:inlinedMark]
+}
+
+func isLoopExit(node *Node) bool {
+	return node.Type == "BREAK" || node.Type == "CONTINUE"
+}
+
+// containsLoopExit reports a break or continue that belongs to the enclosing loop
+func containsLoopExit(node *Node) bool {
+	if node == nil || node.Type == "FOR_LOOP" || node.Type == "WHILE_LOOP" || node.Type == "DO_WHILE_LOOP" {
+		return false
+	}
+	if isLoopExit(node) {
+		return true
+	}
+
+	if containsLoopExit(node.Right) {
+		return true
+	}
+	for _, child := range node.Body {
+		if containsLoopExit(child) {
+			return true
+		}
+	}
+	return false
+}
+
 // replaceLoopVar replaces occurrences of the loop variable in a node with a given value.
 func replaceLoopVar(node *Node, loopVar string, value string) *Node {
 	if node == nil {
@@ -673,6 +1651,7 @@ func replaceLoopVar(node *Node, loopVar string, value string) *Node {
 		Left:   replaceLoopVar(node.Left, loopVar, value),
 		Right:  replaceLoopVar(node.Right, loopVar, value),
 		Body:   []*Node{},
+		Pos:    node.Pos,
 	}
 
 	// Replace loop variable if found
@@ -681,6 +1660,7 @@ func replaceLoopVar(node *Node, loopVar string, value string) *Node {
 			Type:  "INT",
 			DType: "INT",
 			Value: value,
+			Pos:   node.Pos,
 		}
 	}
 
@@ -702,14 +1682,6 @@ func atoi(s string) int {
 	return i
 }
 
-func prependNode(body []*Node, node *Node) []*Node {
-	var emptyNode *Node
-	body = append(body, emptyNode)
-	copy(body[1:], body)
-	body[0] = node
-	return body
-}
-
 // Print function to display the optimized AST
 func printAST(root *Node) {
 	fmt.Println("Printing AST...")
@@ -719,6 +1691,11 @@ func printAST(root *Node) {
 }
 
 func updateValueTable(Values *ValueTable, node *Node) {
+	if isResidual(node.Right) {
+		Values.Body = append(Values.Body, unknownValue(node.Left))
+		return
+	}
+
 	ident := node.Left.Value
 	newValue := node.Right.Value
 
@@ -734,6 +1711,7 @@ func updateValueTable(Values *ValueTable, node *Node) {
 			Type:  node.Right.Type,
 			Value: newValue,
 			DType: node.Right.DType,
+			Pos:   node.Right.Pos,
 		},
 	}
 
@@ -750,7 +1728,6 @@ func getFunction(Functions *ValueTable, name string) *Node {
 			return function
 		}
 	}
-	fmt.Println("getFunction: Function Not Found!")
 	return nil
 }
 
@@ -771,18 +1748,53 @@ func finalRound(root *Node) {
 		return
 	}
 
+	// Assignments are only kept for variables the generated code still reads
+	runtimeReads := map[string]bool{}
+	collectRuntimeReads(root, runtimeReads)
+
+	pruneBody(root, runtimeReads)
+}
+
+func pruneBody(root *Node, runtimeReads map[string]bool) {
 	// Process the body slice if it exists
 	if len(root.Body) > 0 {
 		var newBody []*Node
 		for _, child := range root.Body {
 			if child.Type == "ASSIGN" {
-				// Skip nodes with Type == "ASSIGN"
-				continue
+				// Skip assignments whose value was folded into every use
+				if runtimeReads[child.Left.Value] {
+					newBody = append(newBody, child)
+				}
+			} else if child.Type == "ARRAY_VAR" {
+				// an array whose elements were all folded takes no space
+				if runtimeReads[child.Value] {
+					newBody = append(newBody, child)
+				}
+			} else if child.Type == "SWITCH_STATEMENT" {
+				for _, clause := range child.Body {
+					pruneBody(clause, runtimeReads)
+				}
+				newBody = append(newBody, child)
+			} else if child.Type == "FOR_LOOP" {
+				// Loops left for runtime keep their init, condition and step
+				pruneBody(child.Body[1], runtimeReads)
+				newBody = append(newBody, child)
+			} else if child.Type == "WHILE_LOOP" || child.Type == "DO_WHILE_LOOP" {
+				pruneBody(child.Body[0], runtimeReads)
+				newBody = append(newBody, child)
+			} else if child.Type == "IF_STATEMENT" && isResidual(child.Left) {
+				// Keep ifs decided at runtime, pruning both branches
+				pruneBody(child, runtimeReads)
+				if child.Right != nil {
+					pruneBody(child.Right, runtimeReads)
+				}
+				newBody = append(newBody, child)
 			} else if child.Type == "IF_STATEMENT" {
 				// Replace "IF_STATEMENT" node with its Body
+				pruneBody(child, runtimeReads)
 				newBody = append(newBody, child.Body...)
 			} else if child.Type == "FUNCTION_DECL" {
-				finalRound(child)
+				pruneBody(child, runtimeReads)
 				newBody = append(newBody, child.Body...)
 			} else {
 				// Keep other nodes as they are
@@ -792,3 +1804,100 @@ func finalRound(root *Node) {
 		root.Body = newBody
 	}
 }
+
+// collectRuntimeReads records every variable that is read by code left for runtime
+func collectRuntimeReads(node *Node, runtimeReads map[string]bool) {
+	if node == nil {
+		return
+	}
+
+	if node.Type == "IDENTIFIER" || node.Type == "ARRAY_ELEMENT" {
+		runtimeReads[node.Value] = true
+	}
+
+	// the variable an assignment stores to is written, not read, but the
+	// index of an element written to is, and so is any other operand
+	switch {
+	case node.Type != "ASSIGN":
+		collectRuntimeReads(node.Left, runtimeReads)
+	case node.Left == nil || node.Left.Type == "IDENTIFIER":
+	case node.Left.Type == "ARRAY_ELEMENT":
+		collectRuntimeReads(node.Left.Left, runtimeReads)
+	default:
+		collectRuntimeReads(node.Left, runtimeReads)
+	}
+	collectRuntimeReads(node.Right, runtimeReads)
+
+	for _, param := range node.Params {
+		collectRuntimeReads(param, runtimeReads)
+	}
+	for _, child := range node.Body {
+		collectRuntimeReads(child, runtimeReads)
+	}
+}
+
+// forgetAssigned marks every variable assigned inside node as unknown,
+// including by the functions it calls
+func forgetAssigned(node *Node) {
+	forgetAssignedBy(node, map[string]bool{})
+}
+
+// forgetAssignedBy is forgetAssigned, with the functions whose bodies are
+// already being walked, so a recursive one is only walked once
+func forgetAssignedBy(node *Node, calling map[string]bool) {
+	if node == nil {
+		return
+	}
+
+	switch {
+	case node.Type == "ARRAY_VAR":
+		Values.Body = append(Values.Body, unknownValue(&Node{Value: node.Value + "[]", DType: scalarType(node.DType)}))
+	case node.Type == "FUNCTION_CALL" && !calling[node.Value]:
+		// a call not inlined yet assigns whatever its function's body does
+		if funcNode := getFunction(&Functions, node.Value); funcNode != nil {
+			calling[node.Value] = true
+			for _, stmt := range funcNode.Body {
+				forgetAssignedBy(stmt, calling)
+			}
+			delete(calling, node.Value)
+		}
+	case node.Type != "ASSIGN" || node.Left == nil:
+	case node.Left.Type == "ARRAY_INDEX" || node.Left.Type == "ARRAY_ELEMENT" || isArrayType(node.Left.DType):
+		// which element is written may only be known at runtime
+		Values.Body = append(Values.Body, unknownValue(&Node{Value: node.Left.Value + "[]", DType: scalarType(node.Left.DType)}))
+	case node.Left.Type == "IDENTIFIER":
+		for _, leaf := range structLeaves(node.Left.Value, node.Left.DType, node.Left.Pos) {
+			Values.Body = append(Values.Body, unknownValue(leaf))
+		}
+	}
+
+	// calls can be anywhere in an expression, like in a condition or an argument
+	if node.Type != "ASSIGN" {
+		forgetAssignedBy(node.Left, calling)
+	}
+	forgetAssignedBy(node.Right, calling)
+	for _, param := range node.Params {
+		forgetAssignedBy(param, calling)
+	}
+	for _, child := range node.Body {
+		forgetAssignedBy(child, calling)
+	}
+}
+
+// unknownValue is a value table entry saying ident can only be read at runtime
+func unknownValue(ident *Node) *Node {
+	return &Node{
+		Type: "ASSIGN",
+		Left: &Node{
+			Type:  "IDENTIFIER",
+			Value: ident.Value,
+			DType: ident.DType,
+		},
+		Right: &Node{
+			Type:  "IDENTIFIER",
+			Value: ident.Value,
+			DType: ident.DType,
+			Pos:   ident.Pos,
+		},
+	}
+}
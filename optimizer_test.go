@@ -0,0 +1,153 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCollectRuntimeReads(t *testing.T) {
+	identifier := func(name string) *Node {
+		return &Node{Type: "IDENTIFIER", Value: name, DType: "INT"}
+	}
+	assign := func(target *Node, value *Node) *Node {
+		return &Node{Type: "ASSIGN", DType: "OP", Value: "=", Left: target, Right: value}
+	}
+
+	tests := []struct {
+		name  string
+		node  *Node
+		reads []string
+	}{
+		{"target is not read", assign(identifier("a"), identifier("b")), []string{"b"}},
+		{"index of a target is read", assign(&Node{Type: "ARRAY_ELEMENT", Value: "arr", Left: identifier("i")}, identifier("b")), []string{"b", "i"}},
+		{"missing target", assign(nil, identifier("b")), []string{"b"}},
+		{"nested assignment", assign(identifier("a"), assign(identifier("b"), identifier("c"))), []string{"c"}},
+		{"assignment without a target in a body", &Node{Body: []*Node{assign(nil, assign(nil, identifier("c")))}}, []string{"c"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runtimeReads := map[string]bool{}
+			collectRuntimeReads(test.node, runtimeReads)
+			if reads := slices.Sorted(maps.Keys(runtimeReads)); !slices.Equal(reads, test.reads) {
+				t.Errorf("reads %v, want %v", reads, test.reads)
+			}
+		})
+	}
+}
+
+// sideEffects are functions that write what they are called with, so a
+// test can tell whether and in which order they ran
+const sideEffects = `
+global int calls = 0
+func check(int v) bool {
+    write("check ")
+    calls++
+    return v > 5
+}
+func one() int {
+    write("one ")
+    return 1
+}
+func two() int {
+    write("two ")
+    return 2
+}
+`
+
+func TestShortCircuitRunsCallsOnlyWhenNeeded(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"and skips", runtimeValue + sideEffects + "if (n < 0 && check(n)) {\n    write(\"yes \")\n}\nwrite(calls)\n", "0"},
+		{"and runs", runtimeValue + sideEffects + "if (n > 0 && check(n)) {\n    write(\"yes \")\n}\nwrite(calls)\n", "check yes 1"},
+		{"or skips", runtimeValue + sideEffects + "if (n > 0 || check(n)) {\n    write(\"yes \")\n}\nwrite(calls)\n", "yes 0"},
+		{"or runs", runtimeValue + sideEffects + "if (n < 0 || check(n)) {\n    write(\"yes \")\n}\nwrite(calls)\n", "check yes 1"},
+		{"value", runtimeValue + sideEffects + "bool b = n < 0 && check(n)\nwrite(b)\nwrite(calls)\n", "00"},
+		{"nested", runtimeValue + sideEffects + "if (n < 0 && (check(n) || check(n + 1))) {\n    write(\"yes \")\n}\nwrite(calls)\n", "0"},
+		{"loop condition", runtimeValue + sideEffects + "int k = 0\nwhile (k < 2 && check(n)) {\n    k++\n}\nwrite(k)\n", "check check 2"},
+	})
+}
+
+func TestTernaryRunsOnlyTheArmPicked(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"then", runtimeValue + sideEffects + "int r = n > 0 ? one() : two()\nwrite(r)\n", "one 1"},
+		{"else", runtimeValue + sideEffects + "int r = n < 0 ? one() : two()\nwrite(r)\n", "two 2"},
+		{"nested", runtimeValue + sideEffects + "int r = n < 0 ? one() : n > 5 ? two() : one()\nwrite(r)\n", "two 2"},
+		{"in a call", runtimeValue + sideEffects + "write(n < 0 ? one() : two())\n", "two 2"},
+		{"constant condition", sideEffects + "write(True ? one() : two())\n", "one 1"},
+	})
+}
+
+func TestRuntimeLoopForgetsWhatCallsAssign(t *testing.T) {
+	const bump = "global int bumps = 0\nfunc bump() {\n    bumps++\n}\n"
+	checkOutput(t, []outputCase{
+		{"body", runtimeValue + bump + "int k = 0\nwhile (k < n) {\n    bump()\n    k++\n}\nwrite(bumps)\n", "2000"},
+		{"for body", runtimeValue + bump + "for (int i = 0; i < n; i++) {\n    bump()\n}\nwrite(bumps)\n", "2000"},
+		{"condition", runtimeValue + sideEffects + "int k = 0\nwhile (k < 2 && check(n)) {\n    k++\n}\nwrite(calls)\n", "check check 2"},
+	})
+}
+
+func TestInlinedCallsStoreTheirOwnLocals(t *testing.T) {
+	const double = "func f(int a) int {\n    a = a * 2\n    return a\n}\n"
+	const nested = "func g(int x) int {\n    return x * 10\n}\nfunc f(int x) int {\n    int y = g(x + 1)\n    return x + y\n}\n"
+	const recursive = "func sum(int k) int {\n    int r = 0\n    if (k > 0) {\n        r = sum(k - 1)\n    }\n    return k + r\n}\n"
+	checkOutput(t, []outputCase{
+		{"param and variable", double + "int a = 5\nint b = f(3)\nwrite(a)\nwrite(b)\n", "56"},
+		{"runtime param", runtimeValue + double + "int a = 5\nint b = f(n)\nwrite(a)\nwrite(b)\n", "54000"},
+		{"nested calls", nested + "write(f(1))\n", "21"},
+		{"runtime nested calls", runtimeValue + nested + "write(f(n))\n", "22010"},
+		{"recursion", recursive + "write(sum(3))\n", "6"},
+	})
+}
+
+func TestCappedLoopsWarn(t *testing.T) {
+	const capped = "warning: Loop is still running after 1000 iterations at compile time, it is left for runtime"
+	tests := []struct {
+		name     string
+		source   string
+		warnings int
+	}{
+		{"while", runtimeValue, 1},
+		{"for", "int s = 0\nfor (int i = 0; i < 1500; i++) {\n    s = s + i\n}\nwrite(s)\n", 1},
+		{"for in an unrolled loop", "int s = 0\nfor (int j = 0; j < 3; j++) {\n    for (int i = 0; i < 1500; i++) {\n        s = s + i\n    }\n}\nwrite(s)\n", 1},
+		{"for under the cap", "int s = 0\nfor (int i = 0; i < 1000; i++) {\n    s = s + i\n}\nwrite(s)\n", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := compile(t, test.source)
+			if warnings := strings.Count(result.diagnostics, capped); warnings != test.warnings {
+				t.Errorf("warned %d times, want %d:\n%s", warnings, test.warnings, result.diagnostics)
+			}
+		})
+	}
+
+	checkOutput(t, []outputCase{
+		{"for runs at runtime", "int s = 0\nfor (int i = 0; i < 1500; i++) {\n    s = s + i\n}\nwrite(s)\n", "1124250"},
+	})
+}
+
+func TestWhileLoops(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"unrolled", "int i = 0\nint s = 0\nwhile (i < 5) {\n    s = s + i\n    i++\n}\nwrite(s)\nwrite(i)\n", "105"},
+		{"never runs", "int i = 9\nwhile (i < 5) {\n    i++\n}\nwrite(i)\n", "9"},
+		{"runtime", runtimeValue + "write(n)\n", "2000"},
+		{"runtime condition", runtimeValue + "int k = 0\nwhile (k * k < n) {\n    k++\n}\nwrite(k)\n", "45"},
+		{"runtime nested", runtimeValue + "int i = 0\nint s = 0\nwhile (i < n) {\n    int j = 0\n    while (j < 3) {\n        s++\n        j++\n    }\n    i = i + 500\n}\nwrite(s)\n", "12"},
+		{"do while runs once", "int i = 9\ndo {\n    i++\n} while (i < 5)\nwrite(i)\n", "10"},
+		{"runtime do while", runtimeValue + "int i = 0\ndo {\n    i = i + 7\n} while (i < n)\nwrite(i)\n", "2002"},
+		{"value after the loop", runtimeValue + "int m = n\nwhile (m > 10) {\n    m = m / 3\n}\nwrite(m + 1)\n", "9"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"no parentheses", "int x = 0\nwhile x < 3 {\n}\n", "Expected \"(\" got x"},
+		{"unclosed", "while (1 < 2 {\n}\n", "Missing closing \")\" in while condition"},
+		{"empty", "while () {\n}\n", "Missing condition in while loop"},
+		{"int condition", "int x = 0\nwhile (x) {\n    x++\n}\n", "Condition of while must be BOOL, got INT"},
+		{"do without while", "do {\n}\n", "Expected while (condition) after do block"},
+		{"do while without parentheses", "int x = 0\ndo {\n} while x\n", "Expected \"(\" after while"},
+		{"do while empty", "do {\n} while ()\n", "Missing condition in while loop"},
+		{"do while int condition", "int x = 0\ndo {\n    x++\n} while (x)\n", "Condition of while must be BOOL, got INT"},
+		{"for int condition", "for (int i = 0; i + 1; i++) {\n}\n", "Condition of for must be BOOL, got INT"},
+	})
+}
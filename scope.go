@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Scope is one level of the symbol table: the top level, a function's params
+// and body, the body of an if, else, case or loop, or the header of a for
+// loop, which holds the variable its init declares
+type Scope struct {
+	Kind    string // "GLOBAL", "FUNCTION", "BLOCK" or "LOOP"
+	Symbols map[string]*Node
+	Parent  *Scope
+}
+
+// currentScope is the innermost scope of the code being parsed
+var currentScope = &Scope{Kind: "GLOBAL", Symbols: make(map[string]*Node)}
+
+// WarnShadow turns the warning for a declaration that shadows another on or
+// off, with the -shadow flag
+var WarnShadow = true
+
+// shadowCount numbers the variables renamed because they shadow another, and
+// the params and locals of each inlined call
+var shadowCount int
+
+// functionLocals lists by function the names of its params and locals. Each
+// inlined call to the function renames them, to store them apart from those
+// of any other call
+var functionLocals = make(map[string][]string)
+
+// openScope starts a scope inside the current one
+func openScope(kind string) {
+	currentScope = &Scope{Kind: kind, Symbols: make(map[string]*Node), Parent: currentScope}
+}
+
+// closeScope drops the innermost scope and everything declared in it
+func closeScope() {
+	currentScope = currentScope.Parent
+}
+
+// parseScoped parses a block of statements in a scope of its own
+func parseScoped(tokens []Token, root *Node, kind string) *Node {
+	openScope(kind)
+	defer closeScope()
+	return parse(tokens, root)
+}
+
+// lookupSymbol finds the symbol a name refers to, from the innermost scope
+// out. From inside a function only the globals, consts, enum members and
+// functions of the top level can be seen
+func lookupSymbol(name string) *Node {
+	inFunction := false
+	for scope := currentScope; scope != nil; scope = scope.Parent {
+		symbol, exists := scope.Symbols[name]
+		if exists && (!inFunction || scope.Kind != "GLOBAL" || symbol.Scope == "GLOBAL" || symbol.Type == "FUNCTION_DECL") {
+			return symbol
+		}
+		if scope.Kind == "FUNCTION" {
+			inFunction = true
+		}
+	}
+	return nil
+}
+
+// enclosingSymbol finds a symbol with the name in a scope around the current
+// one, seen from it or not
+func enclosingSymbol(name string) *Node {
+	for scope := currentScope.Parent; scope != nil; scope = scope.Parent {
+		if symbol, exists := scope.Symbols[name]; exists {
+			return symbol
+		}
+	}
+	return nil
+}
+
+// declareSymbol adds a symbol to the current scope. A name can only be
+// declared once per scope. A declaration with the name of one in an
+// enclosing scope shadows it, and is warned about unless -shadow=false.
+// Variables only live in the value table and the generated code by name,
+// so the symbol is renamed to "x.1" to keep it apart from the one it shadows
+func declareSymbol(symbol *Node) {
+	name := symbol.Value
+	if previous, exists := currentScope.Symbols[name]; exists {
+		errorAt(symbol.Pos, name+" has already been declared in this scope", noteAt(previous.Pos, "previous declaration of "+name+" is here"))
+	}
+
+	if outer := enclosingSymbol(name); outer != nil {
+		if WarnShadow && lookupSymbol(name) == outer {
+			warningAt(symbol.Pos, name+" shadows the "+name+" of an enclosing scope", noteAt(outer.Pos, "shadowed declaration of "+name+" is here"))
+		}
+		shadowCount++
+		symbol.Value = name + "." + strconv.Itoa(shadowCount)
+	}
+
+	currentScope.Symbols[name] = symbol
+	// uses of a renamed variable carry its new name, and are looked up by it
+	currentScope.Symbols[symbol.Value] = symbol
+
+	if currentFunction != nil && symbol.Scope != "GLOBAL" {
+		functionLocals[currentFunction.Value] = append(functionLocals[currentFunction.Value], symbol.Value)
+	}
+}
+
+// sourceName is the name a variable was declared with, without the number
+// it was given for shadowing another
+func sourceName(name string) string {
+	base, number, renamed := strings.Cut(name, ".")
+	if _, err := strconv.Atoi(number); renamed && err == nil {
+		return base
+	}
+	return name
+}
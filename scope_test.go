@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScopes(t *testing.T) {
+	checkOutput(t, []outputCase{
+		{"block shadows", runtimeValue + "int x = 1\nif (n > 5) {\n    int x = 5\n    x = x + n\n    write(x)\n}\nwrite(x)\n", "20051"},
+		{"loop body per iteration", "for (int i = 0; i < 3; i++) {\n    int y = i\n    write(y)\n}\n", "012"},
+		{"loop header reused", "for (int i = 0; i < 3; i++) {\n    write(i)\n}\nfor (int i = 0; i < 2; i++) {\n    write(i)\n}\n", "01201"},
+		{"param shadows a global", "global int g = 10\nfunc addG(int g) int {\n    return g + 1\n}\nwrite(addG(3))\nwrite(g)\n", "410"},
+		{"struct shadowed", runtimeValue + "struct P {\n    int a\n}\nP p = P{1}\nif (n > 1) {\n    P p = P{7}\n    write(p.a)\n}\nwrite(p.a)\n", "71"},
+		{"array shadowed", runtimeValue + "[2]int arr = {1, 2}\nwhile (n > 3) {\n    [2]int arr = {8, 9}\n    write(arr[1])\n    n = 0\n}\nwrite(arr[1])\n", "92"},
+	})
+
+	checkDiagnostics(t, []diagnosticCase{
+		{"redeclared", "int a = 1\nint a = 2\n", "2:5: error: a has already been declared in this scope"},
+		{"block does not leak", "if (True) {\n    int b = 3\n}\nwrite(b)\n", "Previously undeclared variable assignment: b"},
+		{"loop header does not leak", "for (int i = 0; i < 3; i++) {\n    write(i)\n}\nwrite(i)\n", "Previously undeclared variable assignment: i"},
+		{"duplicate param", "func f(int n, int n) {\n    write(n)\n}\n", "n has already been declared in this scope"},
+		{"local redeclares a param", "func h(int m) {\n    int m = 2\n}\n", "m has already been declared in this scope"},
+		{"shadow warning", "for (int i = 0; i < 3; i++) {\n    int i = 4\n}\n", "2:9: warning: i shadows the i of an enclosing scope"},
+	})
+
+	t.Run("shadow warning off", func(t *testing.T) {
+		resetCompiler()
+		WarnShadow = false
+		root := Node{}
+		parse(lex("test.josh", "int x = 1\nif (True) {\n    int x = 2\n}\n"), &root)
+		for _, diagnostic := range Diagnostics {
+			if strings.Contains(diagnostic.String(), "shadows") {
+				t.Errorf("warned with -shadow=false:\n%s", diagnostic.String())
+			}
+		}
+	})
+}
@@ -32,7 +32,46 @@ func generateOptimizedTAC(node *Node, writer *bufio.Writer) {
 	switch node.Type {
 	case "ASSIGN":
 		// Generate TAC for assignment
-		handleValue(node.Right, writer)
+		value := handleValue(node.Right, writer)
+		if node.Left.Type == "ARRAY_ELEMENT" {
+			writer.WriteString(fmt.Sprintf("%s = %s\n", elementName(node.Left, writer), value))
+			return
+		}
+		writer.WriteString(fmt.Sprintf("%s = %s\n", variableName(node.Left), value))
+		return
+	case "IF_STATEMENT":
+		endLabel := getLabel()
+		generateIfTAC(node, endLabel, writer)
+		writer.WriteString(fmt.Sprintf("label %s\n", endLabel))
+		return
+	case "SWITCH_STATEMENT":
+		generateSwitchTAC(node, writer)
+		return
+	case "FOR_LOOP":
+		generateOptimizedTAC(node.Body[0], writer)
+		generateLoopTAC(node.Body[1], node.Body[2], true, writer)
+		return
+	case "WHILE_LOOP", "DO_WHILE_LOOP":
+		generateLoopTAC(node.Body[0], nil, node.Type == "WHILE_LOOP", writer)
+		return
+	case "STRUCT_VAR":
+		// the fields of a struct variable, in the order they are laid out
+		fields := []string{}
+		for _, leaf := range structLeaves(node.Value, node.DType, node.Pos) {
+			fields = append(fields, variableName(leaf))
+		}
+		writer.WriteString(fmt.Sprintf("struct %s %s\n", variableName(node), strings.Join(fields, " ")))
+		return
+	case "ARRAY_VAR":
+		// the array's space, in words, zeroed where it is declared
+		writer.WriteString(fmt.Sprintf("array %s %d\n", variableName(node), arraySize(node.DType)))
+		return
+	case "BREAK":
+		writer.WriteString(fmt.Sprintf("goto %s\n", loopLabels[len(loopLabels)-1].breakLabel))
+		return
+	case "CONTINUE":
+		writer.WriteString(fmt.Sprintf("goto %s\n", loopLabels[len(loopLabels)-1].continueLabel))
+		return
 	case "FUNCTION_DECL":
 		// Handle function declaration
 		writer.WriteString(fmt.Sprintf("func %s:\n", node.Value))
@@ -75,6 +114,20 @@ func handleValue(node *Node, writer *bufio.Writer) string {
 		return ""
 	}
 
+	// Variables and expressions that were not folded are computed at runtime
+	if node.Type == "IDENTIFIER" {
+		return variableName(node)
+	}
+	if node.Type == "INLINED" {
+		for _, stmt := range node.Body {
+			generateOptimizedTAC(stmt, writer)
+		}
+		return handleValue(node.Left, writer)
+	}
+	if isResidual(node) {
+		return handleExpression(node, writer)
+	}
+
 	value := node.Value
 	nodeType := node.Type
 
@@ -86,7 +139,11 @@ func handleValue(node *Node, writer *bufio.Writer) string {
 
 	// If not, create a new tempVar
 	tempVar := getOptimizedTempVar(nodeType)
-	line := fmt.Sprintf("%s = %s\n", tempVar, value)
+	literal := value
+	if nodeType == "STRING" || nodeType == "CHAR" {
+		literal = quoteLiteral(value)
+	}
+	line := fmt.Sprintf("%s = %s\n", tempVar, literal)
 	writer.WriteString(line)
 
 	// Store the new tempVar in the symbol table
@@ -95,12 +152,227 @@ func handleValue(node *Node, writer *bufio.Writer) string {
 	return tempVar
 }
 
+// generateIfTAC emits an if and, for an else if chain, every if after it.
+// All the branches of the chain jump to the same endLabel
+func generateIfTAC(node *Node, endLabel string, writer *bufio.Writer) {
+	thenLabel := getLabel()
+	elseLabel := getLabel()
+
+	generateBranchTAC(node.Left, thenLabel, elseLabel, writer)
+
+	writer.WriteString(fmt.Sprintf("label %s\n", thenLabel))
+	for _, stmt := range node.Body {
+		generateOptimizedTAC(stmt, writer)
+	}
+	writer.WriteString(fmt.Sprintf("goto %s\n", endLabel))
+
+	writer.WriteString(fmt.Sprintf("label %s\n", elseLabel))
+	if node.Right == nil {
+		return
+	}
+
+	if len(node.Right.Body) == 1 && node.Right.Body[0].Type == "IF_STATEMENT" && isResidual(node.Right.Body[0].Left) {
+		generateIfTAC(node.Right.Body[0], endLabel, writer)
+		return
+	}
+	for _, stmt := range node.Right.Body {
+		generateOptimizedTAC(stmt, writer)
+	}
+}
+
+// generateSwitchTAC emits one "switch value default case:label ..." line, which
+// the MIPS backend turns into a jump table or a chain of compares, and then
+// every clause under its label
+func generateSwitchTAC(node *Node, writer *bufio.Writer) {
+	value := handleValue(node.Left, writer)
+	endLabel := getLabel()
+	defaultLabel := endLabel
+
+	var cases []string
+	var clauseLabels []string
+	for _, clause := range node.Body {
+		clauseLabel := getLabel()
+		clauseLabels = append(clauseLabels, clauseLabel)
+
+		if clause.Type == "DEFAULT" {
+			defaultLabel = clauseLabel
+		}
+		for _, caseValue := range clause.Params {
+			cases = append(cases, fmt.Sprintf("%d:%s", caseKey(caseValue), clauseLabel))
+		}
+	}
+
+	writer.WriteString(fmt.Sprintf("switch %s %s %s\n", value, defaultLabel, strings.Join(cases, " ")))
+
+	for clauseIndex, clause := range node.Body {
+		writer.WriteString(fmt.Sprintf("label %s\n", clauseLabels[clauseIndex]))
+		for _, stmt := range clause.Body {
+			generateOptimizedTAC(stmt, writer)
+		}
+		writer.WriteString(fmt.Sprintf("goto %s\n", endLabel))
+	}
+
+	writer.WriteString(fmt.Sprintf("label %s\n", endLabel))
+}
+
+// Where break and continue jump to in each enclosing loop, innermost last
+type LoopLabels struct {
+	continueLabel string
+	breakLabel    string
+}
+
+var loopLabels []LoopLabels
+
+// generateLoopTAC emits a loop from its core if (condition and body) and the
+// step run at the end of every iteration, which may be nil. Without
+// checkFirst the condition is only checked after the body, like a do-while
+func generateLoopTAC(core *Node, step *Node, checkFirst bool, writer *bufio.Writer) {
+	startLabel := getLabel()
+	bodyLabel := getLabel()
+	continueLabel := getLabel()
+	endLabel := getLabel()
+
+	writer.WriteString(fmt.Sprintf("label %s\n", startLabel))
+	if checkFirst {
+		generateConditionTAC(core, bodyLabel, endLabel, writer)
+	}
+	writer.WriteString(fmt.Sprintf("label %s\n", bodyLabel))
+
+	loopLabels = append(loopLabels, LoopLabels{continueLabel: continueLabel, breakLabel: endLabel})
+	for _, stmt := range core.Body {
+		generateOptimizedTAC(stmt, writer)
+	}
+	loopLabels = loopLabels[:len(loopLabels)-1]
+
+	writer.WriteString(fmt.Sprintf("label %s\n", continueLabel))
+	generateOptimizedTAC(step, writer)
+	if checkFirst {
+		writer.WriteString(fmt.Sprintf("goto %s\n", startLabel))
+	} else {
+		generateConditionTAC(core, startLabel, endLabel, writer)
+	}
+	writer.WriteString(fmt.Sprintf("label %s\n", endLabel))
+}
+
+// generateConditionTAC checks a loop's condition, first running the
+// statements of any function it calls (the core's Params)
+func generateConditionTAC(core *Node, trueLabel string, falseLabel string, writer *bufio.Writer) {
+	for _, stmt := range core.Params {
+		generateOptimizedTAC(stmt, writer)
+	}
+	generateBranchTAC(core.Left, trueLabel, falseLabel, writer)
+}
+
+// handleExpression emits the TAC computing a residual expression into a new tempVar
+func handleExpression(node *Node, writer *bufio.Writer) string {
+	tempVar := getOptimizedTempVar(node.DType)
+
+	switch node.Type {
+	case "AND", "OR":
+		trueLabel := getLabel()
+		falseLabel := getLabel()
+		endLabel := getLabel()
+
+		generateBranchTAC(node, trueLabel, falseLabel, writer)
+
+		writer.WriteString(fmt.Sprintf("label %s\n", trueLabel))
+		writer.WriteString(fmt.Sprintf("%s = %s\n", tempVar, handleValue(&Node{Type: "BOOL", DType: "BOOL", Value: "TRUE"}, writer)))
+		writer.WriteString(fmt.Sprintf("goto %s\n", endLabel))
+		writer.WriteString(fmt.Sprintf("label %s\n", falseLabel))
+		writer.WriteString(fmt.Sprintf("%s = %s\n", tempVar, handleValue(&Node{Type: "BOOL", DType: "BOOL", Value: "FALSE"}, writer)))
+		writer.WriteString(fmt.Sprintf("label %s\n", endLabel))
+	case "TERNARY":
+		thenLabel := getLabel()
+		elseLabel := getLabel()
+		endLabel := getLabel()
+
+		generateBranchTAC(node.Left, thenLabel, elseLabel, writer)
+
+		writer.WriteString(fmt.Sprintf("label %s\n", thenLabel))
+		writer.WriteString(fmt.Sprintf("%s = %s\n", tempVar, handleValue(node.Params[0], writer)))
+		writer.WriteString(fmt.Sprintf("goto %s\n", endLabel))
+		writer.WriteString(fmt.Sprintf("label %s\n", elseLabel))
+		writer.WriteString(fmt.Sprintf("%s = %s\n", tempVar, handleValue(node.Params[1], writer)))
+		writer.WriteString(fmt.Sprintf("label %s\n", endLabel))
+	case "ARRAY_ELEMENT":
+		writer.WriteString(fmt.Sprintf("%s = %s\n", tempVar, elementName(node, writer)))
+	case "NEGATE", "NOT", "BIT_NOT", "CONVERT":
+		operand := handleValue(node.Left, writer)
+		writer.WriteString(fmt.Sprintf("%s = %s %s\n", tempVar, node.Value, operand))
+	default:
+		left := handleValue(node.Left, writer)
+		right := handleValue(node.Right, writer)
+		writer.WriteString(fmt.Sprintf("%s = %s %s %s\n", tempVar, left, node.Value, right))
+	}
+
+	return tempVar
+}
+
+// generateBranchTAC jumps to trueLabel or falseLabel on a condition. The
+// right operand of && and || is only evaluated when the left one doesn't
+// already decide where to go
+func generateBranchTAC(node *Node, trueLabel string, falseLabel string, writer *bufio.Writer) {
+	switch node.Type {
+	case "AND":
+		rightLabel := getLabel()
+		generateBranchTAC(node.Left, rightLabel, falseLabel, writer)
+		writer.WriteString(fmt.Sprintf("label %s\n", rightLabel))
+		generateBranchTAC(node.Right, trueLabel, falseLabel, writer)
+	case "OR":
+		rightLabel := getLabel()
+		generateBranchTAC(node.Left, trueLabel, rightLabel, writer)
+		writer.WriteString(fmt.Sprintf("label %s\n", rightLabel))
+		generateBranchTAC(node.Right, trueLabel, falseLabel, writer)
+	case "NOT":
+		generateBranchTAC(node.Left, falseLabel, trueLabel, writer)
+	case "INLINED":
+		for _, stmt := range node.Body {
+			generateOptimizedTAC(stmt, writer)
+		}
+		generateBranchTAC(node.Left, trueLabel, falseLabel, writer)
+	default:
+		condition := handleValue(node, writer)
+		writer.WriteString(fmt.Sprintf("if %s goto %s\n", condition, trueLabel))
+		writer.WriteString(fmt.Sprintf("goto %s\n", falseLabel))
+	}
+}
+
+// variableName is the TAC name of a program variable, typed like a tempVar
+func variableName(node *Node) string {
+	return fmt.Sprintf("var_%s_%s", node.Value, tacType(node.DType))
+}
+
+// elementName is an array element as "var_a_INT[index]", first emitting
+// the TAC computing its offset into index
+func elementName(node *Node, writer *bufio.Writer) string {
+	return fmt.Sprintf("%s[%s]", variableName(node), handleValue(node.Left, writer))
+}
+
+// tacType is the type a value is stored as. Enums are ints, and an array
+// is typed by its elements
+func tacType(dtype string) string {
+	if isArrayType(dtype) {
+		return tacType(scalarType(dtype))
+	}
+	if isEnumType(dtype) {
+		return "INT"
+	}
+	return dtype
+}
+
+var labelCounter int
+
+func getLabel() string {
+	labelCounter++
+	return fmt.Sprintf("L%d", labelCounter)
+}
+
 var optimizedTempVarCounter int
 
 // Function to generate a tempVar with type
 func getOptimizedTempVar(varType string) string {
 	optimizedTempVarCounter++
-	tempVar := fmt.Sprintf("opt_t%d_%s", optimizedTempVarCounter, varType)
+	tempVar := fmt.Sprintf("opt_t%d_%s", optimizedTempVarCounter, tacType(varType))
 	return tempVar
 }
 